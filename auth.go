@@ -0,0 +1,261 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransportFunc is an adapter allowing a function to be used as an http.RoundTripper
+type TransportFunc func(req *http.Request) (*http.Response, error)
+
+func (f TransportFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// TransportMiddleware wraps an http.RoundTripper to alter the requests it sends, e.g. to authenticate them
+type TransportMiddleware func(next http.RoundTripper) http.RoundTripper
+
+// ChainTransport wraps base (http.DefaultTransport if nil) in each middleware, the first being outermost i.e. the
+// first to see each request
+func ChainTransport(base http.RoundTripper, middleware ...TransportMiddleware) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	for i := len(middleware) - 1; i >= 0; i-- {
+		base = middleware[i](base)
+	}
+
+	return base
+}
+
+// setHeaderMiddleware returns middleware which sets a header on every request, unless already set
+func setHeaderMiddleware(key, value string) TransportMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return TransportFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get(key) != "" {
+				return next.RoundTrip(req)
+			}
+			req = req.Clone(req.Context())
+			req.Header.Set(key, value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// BearerToken returns middleware which authenticates requests with 'Authorization: Bearer token'
+func BearerToken(token string) TransportMiddleware {
+	return setHeaderMiddleware("Authorization", "Bearer "+token)
+}
+
+// BasicAuth returns middleware which authenticates requests with HTTP basic authentication
+func BasicAuth(username, password string) TransportMiddleware {
+	req := &http.Request{Header: make(http.Header)}
+	req.SetBasicAuth(username, password)
+
+	return setHeaderMiddleware("Authorization", req.Header.Get("Authorization"))
+}
+
+// APIKey returns middleware which authenticates requests by sending key in the given header e.g. X-API-Key
+func APIKey(header, key string) TransportMiddleware {
+	return setHeaderMiddleware(header, key)
+}
+
+// HMACSignature returns middleware which signs every request with secret, sending the signature, as computed by
+// HMACRequestSignature, in an X-Signature header together with the X-Signature-Timestamp used and, if not empty, the
+// keyID in an X-Key-Id header identifying which secret was used
+func HMACSignature(keyID string, secret []byte) TransportMiddleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return TransportFunc(func(req *http.Request) (*http.Response, error) {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req = req.Clone(req.Context())
+			if req.Body != nil && req.Body != http.NoBody {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+			}
+			req.Header.Set("X-Signature-Timestamp", timestamp)
+			req.Header.Set("X-Signature", HMACRequestSignature(secret, req.Method, req.URL.RequestURI(), timestamp, body))
+			if keyID != "" {
+				req.Header.Set("X-Key-Id", keyID)
+			}
+
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// HMACRequestSignature returns the hex encoded HMAC-SHA256, keyed with secret, of the request method, URI (path & query),
+// timestamp and hex encoded SHA-256 of the body, each separated by a newline
+func HMACRequestSignature(secret []byte, method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{method, requestURI, timestamp, hex.EncodeToString(bodyHash[:])}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readRequestBody returns the body of req, using GetBody where possible. Otherwise the body is consumed, so, as a
+// round tripper must not modify its request, callers send a clone of req with a new body made from the bytes returned
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+
+	defer req.Body.Close()
+
+	return io.ReadAll(req.Body)
+}
+
+// ClientCredentials configures the OAuth2 client credentials grant (RFC 6749 section 4.4) used by OAuth2ClientCredentials
+type ClientCredentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// Client, if set, is used to fetch tokens; otherwise they are fetched through the transport being wrapped
+	Client *http.Client
+}
+
+// oauth2Token is a cached access token
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	expiry      time.Time
+}
+
+// OAuth2ClientCredentials returns middleware which authenticates requests with an access token fetched using the
+// client credentials grant. The token is cached until shortly before it expires, then fetched again; should the remote
+// service respond 401 Unauthorized the token is discarded and the request sent once more with a new token
+func OAuth2ClientCredentials(credentials ClientCredentials) TransportMiddleware {
+	var mu sync.Mutex
+	var cached *oauth2Token
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		tokenClient := credentials.Client
+		if tokenClient == nil {
+			tokenClient = &http.Client{Transport: next}
+		}
+
+		// token returns the cached token, fetching a new one if there is none or it has expired
+		token := func(ctx context.Context, stale *oauth2Token) (*oauth2Token, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if cached != nil && cached != stale && time.Now().Before(cached.expiry) {
+				return cached, nil
+			}
+			fetched, err := fetchClientCredentialsToken(ctx, tokenClient, credentials)
+			if err != nil {
+				return nil, err
+			}
+			cached = fetched
+
+			return cached, nil
+		}
+
+		return TransportFunc(func(req *http.Request) (*http.Response, error) {
+			body, err := readRequestBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			var used *oauth2Token
+			for attempt := 1; ; attempt++ {
+				used, err = token(req.Context(), used)
+				if err != nil {
+					return nil, err
+				}
+
+				authorized := req.Clone(req.Context())
+				if req.Body != nil && req.Body != http.NoBody {
+					authorized.Body = io.NopCloser(bytes.NewReader(body))
+				}
+				authorized.Header.Set("Authorization", "Bearer "+used.AccessToken)
+
+				response, err := next.RoundTrip(authorized)
+				if err != nil || response.StatusCode != http.StatusUnauthorized || attempt > 1 {
+					return response, err
+				}
+
+				// token may have been revoked, so discard the response and try once more with a new token
+				_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+				response.Body.Close()
+			}
+		})
+	}
+}
+
+// fetchClientCredentialsToken requests an access token from the token endpoint, authenticating with basic auth
+func fetchClientCredentialsToken(ctx context.Context, client *http.Client, credentials ClientCredentials) (*oauth2Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(credentials.Scopes) > 0 {
+		form.Set("scope", strings.Join(credentials.Scopes, " "))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, credentials.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(credentials.ClientID), url.QueryEscape(credentials.ClientSecret))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OAuth2 token: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching OAuth2 token: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		remote := &RemoteResponse{StatusCode: response.StatusCode, Header: response.Header, Body: body}
+		return nil, fmt.Errorf("error fetching OAuth2 token: %w", newRemoteError(request, remote))
+	}
+
+	var token oauth2Token
+	if err := json.Unmarshal(body, &token); err != nil || token.AccessToken == "" {
+		return nil, fmt.Errorf("error fetching OAuth2 token: response contains no access_token")
+	}
+
+	// renew token a little before it expires; tokens without an expiry are renewed hourly
+	lifetime := time.Hour
+	if token.ExpiresIn > 0 {
+		lifetime = time.Duration(token.ExpiresIn) * time.Second
+	}
+	margin := lifetime / 10
+	if margin > time.Minute {
+		margin = time.Minute
+	}
+	token.expiry = time.Now().Add(lifetime - margin)
+
+	return &token, nil
+}
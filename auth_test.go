@@ -0,0 +1,204 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// recordingTransport records the last request it receives and responds with status
+func recordingTransport(status int, last **http.Request, lastBody *string) http.RoundTripper {
+	return TransportFunc(func(req *http.Request) (*http.Response, error) {
+		*last = req
+		if req.Body != nil {
+			body, _ := io.ReadAll(req.Body)
+			*lastBody = string(body)
+		}
+		return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}, nil
+	})
+}
+
+func TestTools_AuthMiddleware(t *testing.T) {
+	var last *http.Request
+	var lastBody string
+
+	var authTests = []struct {
+		testName   string
+		middleware TransportMiddleware
+		header     string
+		expected   string
+	}{
+		{testName: "bearer", middleware: BearerToken("abc"), header: "Authorization", expected: "Bearer abc"},
+		{testName: "basic", middleware: BasicAuth("joe", "secret"), header: "Authorization", expected: "Basic am9lOnNlY3JldA=="},
+		{testName: "api key", middleware: APIKey("X-API-Key", "k1"), header: "X-Api-Key", expected: "k1"},
+	}
+
+	for _, e := range authTests {
+		testTool := Tools{
+			HTTPClient:       &http.Client{Transport: recordingTransport(200, &last, &lastBody)},
+			RemoteMiddleware: []TransportMiddleware{e.middleware},
+		}
+
+		_, err := testTool.GetJSON("http://example.com/items", nil)
+		if err != nil {
+			t.Errorf("%s: error NOT expected but was generated: %s", e.testName, err.Error())
+			continue
+		}
+		if last.Header.Get(e.header) != e.expected {
+			t.Errorf("%s: expected %s %q but received %q", e.testName, e.header, e.expected, last.Header.Get(e.header))
+		}
+	}
+
+	// middleware does not alter the caller's request
+	req, _ := http.NewRequest("GET", "http://example.com", nil)
+	_, _ = ChainTransport(recordingTransport(200, &last, &lastBody), BearerToken("abc"), APIKey("X-API-Key", "k1")).RoundTrip(req)
+	if req.Header.Get("Authorization") != "" || last.Header.Get("Authorization") != "Bearer abc" || last.Header.Get("X-API-Key") != "k1" {
+		t.Errorf("incorrect chained headers: caller %v, sent %v", req.Header, last.Header)
+	}
+}
+
+func TestTools_HMACSignature(t *testing.T) {
+	var last *http.Request
+	var lastBody string
+
+	secret := []byte("shhh")
+	testTool := Tools{
+		HTTPClient:       &http.Client{Transport: recordingTransport(200, &last, &lastBody)},
+		RemoteMiddleware: []TransportMiddleware{HMACSignature("key-1", secret)},
+	}
+
+	_, err := testTool.PostJSON("http://example.com/orders?x=1", map[string]int{"qty": 2}, nil)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	timestamp := last.Header.Get("X-Signature-Timestamp")
+	expected := HMACRequestSignature(secret, "POST", "/orders?x=1", timestamp, []byte(lastBody))
+	if timestamp == "" || last.Header.Get("X-Signature") != expected || last.Header.Get("X-Key-Id") != "key-1" {
+		t.Errorf("incorrect signature headers: %v", last.Header)
+	}
+	if lastBody != `{"qty":2}` {
+		t.Errorf("body not sent after signing: %q", lastBody)
+	}
+
+	// signature covers the body
+	if HMACRequestSignature(secret, "POST", "/orders?x=1", timestamp, []byte(`{"qty":3}`)) == expected {
+		t.Error("signature of a different body should differ")
+	}
+
+	// the caller's request is not modified, even if its body cannot be read again through GetBody
+	callerBody := io.NopCloser(strings.NewReader(`{"qty":4}`))
+	req, _ := http.NewRequest("POST", "http://example.com/orders", callerBody)
+	req.GetBody = nil
+	_, err = ChainTransport(recordingTransport(200, &last, &lastBody), HMACSignature("key-1", secret)).RoundTrip(req)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	if req.Body != callerBody || req.Header.Get("X-Signature") != "" {
+		t.Error("caller's request was modified")
+	}
+	if lastBody != `{"qty":4}` {
+		t.Errorf("body not sent after signing: %q", lastBody)
+	}
+}
+
+func TestTools_OAuth2ClientCredentials(t *testing.T) {
+	var tokenRequests, apiRequests int32
+	var revoked atomic.Bool
+
+	transport := TransportFunc(func(req *http.Request) (*http.Response, error) {
+		respond := func(status int, body string) (*http.Response, error) {
+			return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewBufferString(body)), Header: make(http.Header)}, nil
+		}
+
+		if req.URL.Path == "/token" {
+			n := atomic.AddInt32(&tokenRequests, 1)
+			body, _ := io.ReadAll(req.Body)
+			user, pass, _ := req.BasicAuth()
+			if user != "client" || pass != "secret" || !strings.Contains(string(body), "grant_type=client_credentials") || !strings.Contains(string(body), "scope=read+write") {
+				return respond(401, `{"error":"invalid_client"}`)
+			}
+			token, _ := json.Marshal(map[string]interface{}{"access_token": "token" + string(rune('0'+n)), "expires_in": 3600})
+			return respond(200, string(token))
+		}
+
+		atomic.AddInt32(&apiRequests, 1)
+		if revoked.Load() && req.Header.Get("Authorization") == "Bearer token1" {
+			return respond(401, `{"message":"token revoked"}`)
+		}
+		body, _ := io.ReadAll(req.Body)
+		return respond(200, `{"auth":"`+req.Header.Get("Authorization")+`","body":`+string(body)+`}`)
+	})
+
+	testTool := Tools{
+		HTTPClient: &http.Client{Transport: transport},
+		RemoteMiddleware: []TransportMiddleware{OAuth2ClientCredentials(ClientCredentials{
+			TokenURL: "http://auth.example.com/token", ClientID: "client", ClientSecret: "secret", Scopes: []string{"read", "write"},
+		})},
+	}
+
+	var result struct {
+		Auth string `json:"auth"`
+		Body struct {
+			N int `json:"n"`
+		} `json:"body"`
+	}
+
+	// token is fetched once and cached
+	for i := 0; i < 3; i++ {
+		_, err := testTool.PostJSON("http://api.example.com/items", map[string]int{"n": i}, &result)
+		if err != nil {
+			t.Fatal("error NOT expected but was generated:", err)
+		}
+	}
+	if tokenRequests != 1 || result.Auth != "Bearer token1" || result.Body.N != 2 {
+		t.Errorf("expected cached token but made %d token requests, sent %+v", tokenRequests, result)
+	}
+
+	// revoked token is replaced and the request sent again, with its body
+	revoked.Store(true)
+	_, err := testTool.PostJSON("http://api.example.com/items", map[string]int{"n": 9}, &result)
+	if err != nil || tokenRequests != 2 || result.Auth != "Bearer token2" || result.Body.N != 9 {
+		t.Errorf("expected token refresh but received %v after %d token requests, sent %+v", err, tokenRequests, result)
+	}
+
+	// invalid credentials are reported
+	testTool.RemoteMiddleware = []TransportMiddleware{OAuth2ClientCredentials(ClientCredentials{TokenURL: "http://auth.example.com/token", ClientID: "bad"})}
+	_, err = testTool.GetJSON("http://api.example.com/items", nil)
+	if err == nil || !strings.Contains(err.Error(), "OAuth2 token") {
+		t.Errorf("expected token error but received %v", err)
+	}
+}
+
+func TestTools_OAuth2ClientCredentialsEndlessBody(t *testing.T) {
+	endless := &endlessBody{}
+	apiRequests := 0
+	transport := TransportFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/token" {
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{"access_token":"t"}`)), Header: make(http.Header)}, nil
+		}
+		apiRequests++
+		if apiRequests == 1 {
+			return &http.Response{StatusCode: 401, Body: endless, Header: make(http.Header)}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}, nil
+	})
+
+	testTool := Tools{
+		HTTPClient:       &http.Client{Transport: transport},
+		RemoteMiddleware: []TransportMiddleware{OAuth2ClientCredentials(ClientCredentials{TokenURL: "http://auth.example.com/token"})},
+	}
+
+	// the body of the 401 response is discarded without reading it all
+	_, err := testTool.GetJSON("http://api.example.com/items", nil)
+	if err != nil || apiRequests != 2 {
+		t.Fatalf("expected request to be sent again but received %v after %d requests", err, apiRequests)
+	}
+	if endless.read > 2<<20 {
+		t.Errorf("read %d bytes of the 401 response's body", endless.read)
+	}
+}
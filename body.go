@@ -0,0 +1,102 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// jsonRequestBody checks the Content-Type of r, if RequireJSONContentType is set, against application/json, any +json
+// type and the given media types, then returns the request body, decompressed according to its Content-Encoding. The
+// MaxJSONPayloadSize limit is applied both before and after decompression
+func (t *Tools) jsonRequestBody(w http.ResponseWriter, r *http.Request, mediaTypes ...string) (io.Reader, error) {
+	maxBytes := int64(t.jsonPayloadLimit())
+
+	if t.RequireJSONContentType {
+		err := checkJSONContentType(r.Header.Get("Content-Type"), mediaTypes...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	var body io.ReadCloser
+	var err error
+	switch encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		return r.Body, nil
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(r.Body)
+	case "deflate":
+		body, err = zlib.NewReader(r.Body)
+	default:
+		return nil, &JSONError{Code: CodeUnsupportedMediaType, Err: ErrUnsupportedMediaType,
+			Message: fmt.Sprintf("request body content encoding %q is not supported", encoding)}
+	}
+	if err != nil {
+		return nil, &JSONError{Code: CodeInvalidEncoding, Message: "request body could not be decompressed", Err: err}
+	}
+
+	return http.MaxBytesReader(w, decompressingReader{body}, maxBytes), nil
+}
+
+// decompressionError is returned when a compressed request body is corrupt or truncated part way through
+type decompressionError struct {
+	err error
+}
+
+func (e *decompressionError) Error() string {
+	return "request body could not be decompressed: " + e.err.Error()
+}
+
+func (e *decompressionError) Unwrap() error {
+	return e.err
+}
+
+// decompressingReader marks errors reading a decompressed body, other than the end of the body or it being too large,
+// as a *decompressionError so that they are not mistaken for badly formed JSON
+type decompressingReader struct {
+	io.ReadCloser
+}
+
+func (d decompressingReader) Read(p []byte) (int, error) {
+	n, err := d.ReadCloser.Read(p)
+	if err != nil && err != io.EOF && err.Error() != "http: request body too large" {
+		err = &decompressionError{err: err}
+	}
+
+	return n, err
+}
+
+// checkJSONContentType reports an error unless contentType is application/json, a +json type or one of mediaTypes,
+// with a charset, if given, of UTF-8
+func checkJSONContentType(contentType string, mediaTypes ...string) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &JSONError{Code: CodeUnsupportedMediaType, Err: ErrUnsupportedMediaType,
+			Message: "request body must have a Content-Type of application/json"}
+	}
+
+	allowed := mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	for _, m := range mediaTypes {
+		if mediaType == m {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return &JSONError{Code: CodeUnsupportedMediaType, Err: ErrUnsupportedMediaType,
+			Message: fmt.Sprintf("request body Content-Type %q is not supported", mediaType)}
+	}
+
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") && !strings.EqualFold(charset, "utf8") {
+		return &JSONError{Code: CodeUnsupportedMediaType, Err: ErrUnsupportedMediaType,
+			Message: fmt.Sprintf("request body charset %q is not supported, it must be UTF-8", charset)}
+	}
+
+	return nil
+}
@@ -0,0 +1,171 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func gzipBody(s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write([]byte(s))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func deflateBody(s string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write([]byte(s))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+var contentTypeTests = []struct {
+	testName       string
+	body           []byte
+	contentType    string
+	encoding       string
+	requireJSON    bool
+	maxSize        int
+	expectedStatus int
+}{
+	{testName: "no content type required", body: []byte(`{"foo": "bar"}`), contentType: "text/plain", requireJSON: false},
+	{testName: "application/json", body: []byte(`{"foo": "bar"}`), contentType: "application/json", requireJSON: true},
+	{testName: "+json suffix with charset", body: []byte(`{"foo": "bar"}`), contentType: "application/vnd.api+json; charset=UTF-8", requireJSON: true},
+	{testName: "missing content type", body: []byte(`{"foo": "bar"}`), contentType: "", requireJSON: true, expectedStatus: http.StatusUnsupportedMediaType},
+	{testName: "wrong content type", body: []byte(`{"foo": "bar"}`), contentType: "text/plain", requireJSON: true, expectedStatus: http.StatusUnsupportedMediaType},
+	{testName: "wrong charset", body: []byte(`{"foo": "bar"}`), contentType: "application/json; charset=iso-8859-1", requireJSON: true, expectedStatus: http.StatusUnsupportedMediaType},
+	{testName: "gzip encoded", body: gzipBody(`{"foo": "bar"}`), contentType: "application/json", encoding: "gzip"},
+	{testName: "deflate encoded", body: deflateBody(`{"foo": "bar"}`), contentType: "application/json", encoding: "deflate"},
+	{testName: "unsupported encoding", body: []byte(`{"foo": "bar"}`), contentType: "application/json", encoding: "br", expectedStatus: http.StatusUnsupportedMediaType},
+	{testName: "invalid gzip", body: []byte(`{"foo": "bar"}`), contentType: "application/json", encoding: "gzip", expectedStatus: http.StatusBadRequest},
+	{testName: "too large after decompression", body: gzipBody(`{"foo": "` + strings.Repeat("a", 4096) + `"}`), contentType: "application/json", encoding: "gzip", maxSize: 1024, expectedStatus: http.StatusRequestEntityTooLarge},
+}
+
+func TestTools_ReadJSONContentType(t *testing.T) {
+	for _, test := range contentTypeTests {
+		var testTool Tools
+		testTool.RequireJSONContentType = test.requireJSON
+		testTool.MaxJSONPayloadSize = test.maxSize
+
+		var decodedJSON struct {
+			Foo string `json:"foo"`
+		}
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		if test.encoding != "" {
+			req.Header.Set("Content-Encoding", test.encoding)
+		}
+		rr := httptest.NewRecorder()
+
+		err := testTool.ReadJSON(rr, req, &decodedJSON)
+		if test.expectedStatus == 0 {
+			if err != nil {
+				t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			} else if decodedJSON.Foo != "bar" {
+				t.Errorf("%s: incorrect value decoded: %q", test.testName, decodedJSON.Foo)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Errorf("%s: error expected but NOT generated", test.testName)
+			continue
+		}
+
+		if test.expectedStatus == http.StatusUnsupportedMediaType && !errors.Is(err, ErrUnsupportedMediaType) {
+			t.Errorf("%s: expected ErrUnsupportedMediaType but received %v", test.testName, err)
+		}
+
+		// status code is taken from the error when reported by ErrorJSON
+		rr = httptest.NewRecorder()
+		_ = testTool.ErrorJSON(rr, err)
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: expected status %d, received %d", test.testName, test.expectedStatus, rr.Code)
+		}
+
+		var payload JSONResponse
+		_ = json.NewDecoder(rr.Body).Decode(&payload)
+		if !payload.Error {
+			t.Errorf("%s: error set to false in JSON... it should be true", test.testName)
+		}
+	}
+}
+
+// corruptChecksum returns a gzip encoded body whose CRC-32 checksum is wrong
+func corruptChecksum(s string) []byte {
+	body := gzipBody(s)
+	body[len(body)-8] ^= 0xff
+	return body
+}
+
+var decompressionErrorTests = []struct {
+	testName     string
+	body         []byte
+	maxSize      int
+	expectedCode string
+}{
+	{testName: "corrupt checksum", body: corruptChecksum(`{"foo": "bar"}`), expectedCode: CodeInvalidEncoding},
+	{testName: "truncated stream", body: gzipBody(`{"foo": "bar"}` + strings.Repeat(" ", 100))[:30], expectedCode: CodeInvalidEncoding},
+	{testName: "too large after value", body: gzipBody(`{"foo": "bar"}` + strings.Repeat(" ", 4096)), maxSize: 1024, expectedCode: CodeBodyTooLarge},
+	{testName: "second value", body: gzipBody(`{"foo": "bar"} {"foo": "baz"}`), expectedCode: CodeMultipleValues},
+	{testName: "second value of another kind", body: gzipBody(`{"foo": "bar"} [1]`), expectedCode: CodeMultipleValues},
+}
+
+func TestTools_ReadJSONDecompressionErrors(t *testing.T) {
+	for _, test := range decompressionErrorTests {
+		testTool := Tools{MaxJSONPayloadSize: test.maxSize}
+
+		var decodedJSON struct {
+			Foo string `json:"foo"`
+		}
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(test.body))
+		req.Header.Set("Content-Encoding", "gzip")
+
+		err := testTool.ReadJSON(httptest.NewRecorder(), req, &decodedJSON)
+		var jsonError *JSONError
+		if !errors.As(err, &jsonError) {
+			t.Errorf("%s: JSONError expected but received %v", test.testName, err)
+			continue
+		}
+		if jsonError.Code != test.expectedCode {
+			t.Errorf("%s: expected code %q but received %q (%v)", test.testName, test.expectedCode, jsonError.Code, err)
+		}
+	}
+}
+
+func TestTools_ReadJSONStreamContentType(t *testing.T) {
+	var testTool Tools
+	testTool.RequireJSONContentType = true
+
+	req := httptest.NewRequest("POST", "/", bytes.NewReader(gzipBody("{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n")))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+
+	items := 0
+	err := testTool.ReadJSONStream(httptest.NewRecorder(), req, func() interface{} {
+		return &map[string]string{}
+	}, func(item interface{}) error {
+		items++
+		return nil
+	})
+	if err != nil {
+		t.Error("error NOT expected but was generated:", err)
+	}
+
+	if items != 2 {
+		t.Errorf("expected 2 items, received %d", items)
+	}
+}
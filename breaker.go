@@ -0,0 +1,203 @@
+package toolkit
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit to a remote host
+type CircuitState int
+
+const (
+	// CircuitClosed lets calls through, counting consecutive failures
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects calls with ErrCircuitOpen until the cool down has passed
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of trial calls through to discover whether the host has recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// CircuitBreaker stops calls to a remote host which is failing, so that callers fail fast rather than waiting on it.
+// Each host has its own circuit, which opens after FailureThreshold consecutive failures (default 5), i.e. network
+// errors or 5xx responses. Once CoolDown has passed (default 30 seconds) the circuit is half-open, letting through up
+// to HalfOpenRequests trial calls (default 1); a successful trial closes the circuit while a failure opens it again.
+// A CircuitBreaker must not be copied after first use
+type CircuitBreaker struct {
+	FailureThreshold int
+	CoolDown         time.Duration
+	HalfOpenRequests int
+	// OnStateChange, if set, is called whenever the circuit to a host changes state
+	OnStateChange func(host string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+// circuit holds the state of the circuit to a single host
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trials   int
+}
+
+// circuitOutcome is the result of a call, as it affects the circuit
+type circuitOutcome int
+
+const (
+	circuitSuccess circuitOutcome = iota
+	circuitFailure
+	circuitIgnored
+)
+
+// State returns the current state of the circuit to host
+func (b *CircuitBreaker) State(host string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.circuits[host]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.coolDown() {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+// allow reports, by returning an error matching ErrCircuitOpen, whether a call to host must be rejected
+func (b *CircuitBreaker) allow(host string) error {
+	if b == nil {
+		return nil
+	}
+
+	var changed func()
+	defer func() {
+		if changed != nil {
+			changed()
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(host)
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= b.coolDown() {
+		changed = b.setState(host, c, CircuitHalfOpen)
+	}
+
+	// set default number of trial calls if not set by user
+	trials := 1
+	if b.HalfOpenRequests > 0 {
+		trials = b.HalfOpenRequests
+	}
+
+	switch {
+	case c.state == CircuitOpen:
+		return fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	case c.state == CircuitHalfOpen && c.trials >= trials:
+		return fmt.Errorf("%w: %s (awaiting trial calls)", ErrCircuitOpen, host)
+	case c.state == CircuitHalfOpen:
+		c.trials++
+	}
+
+	return nil
+}
+
+// record updates the circuit to host with the outcome of a call which was allowed through
+func (b *CircuitBreaker) record(host string, outcome circuitOutcome) {
+	if b == nil {
+		return
+	}
+
+	var changed func()
+	defer func() {
+		if changed != nil {
+			changed()
+		}
+	}()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// set default failure threshold if not set by user
+	threshold := 5
+	if b.FailureThreshold > 0 {
+		threshold = b.FailureThreshold
+	}
+
+	c := b.circuit(host)
+	if c.state == CircuitHalfOpen && c.trials > 0 {
+		c.trials--
+	}
+
+	switch outcome {
+	case circuitSuccess:
+		c.failures = 0
+		if c.state == CircuitHalfOpen {
+			changed = b.setState(host, c, CircuitClosed)
+		}
+
+	case circuitFailure:
+		c.failures++
+		if c.state == CircuitHalfOpen || (c.state == CircuitClosed && c.failures >= threshold) {
+			c.openedAt = time.Now()
+			changed = b.setState(host, c, CircuitOpen)
+		}
+	}
+}
+
+// circuit returns the circuit to host, creating it if necessary; b.mu must be held
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	if b.circuits == nil {
+		b.circuits = make(map[string]*circuit)
+	}
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+
+	return c
+}
+
+// setState changes the state of c, returning a function which notifies OnStateChange once b.mu has been released
+func (b *CircuitBreaker) setState(host string, c *circuit, state CircuitState) func() {
+	from := c.state
+	c.state, c.trials = state, 0
+	if state == CircuitClosed {
+		c.failures = 0
+	}
+
+	if b.OnStateChange == nil || from == state {
+		return nil
+	}
+
+	return func() {
+		b.OnStateChange(host, from, state)
+	}
+}
+
+// coolDown returns the time a circuit stays open
+func (b *CircuitBreaker) coolDown() time.Duration {
+	if b.CoolDown > 0 {
+		return b.CoolDown
+	}
+
+	return 30 * time.Second
+}
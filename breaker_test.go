@@ -0,0 +1,95 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTools_CircuitBreaker(t *testing.T) {
+	var changes []string
+	breaker := &CircuitBreaker{
+		FailureThreshold: 2,
+		CoolDown:         20 * time.Millisecond,
+		OnStateChange: func(host string, from, to CircuitState) {
+			changes = append(changes, host+" "+from.String()+" > "+to.String())
+		},
+	}
+
+	status, calls := http.StatusServiceUnavailable, 0
+	testTool := Tools{
+		CircuitBreaker: breaker,
+		HTTPClient: NewTestClient(func(req *http.Request) *http.Response {
+			calls++
+			return &http.Response{StatusCode: status, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}
+		}),
+	}
+
+	// consecutive failures open the circuit
+	for i := 0; i < 2; i++ {
+		_, _ = testTool.GetJSON("http://down.example.com/items", nil)
+	}
+	if breaker.State("down.example.com") != CircuitOpen {
+		t.Fatalf("expected open circuit but it is %s", breaker.State("down.example.com"))
+	}
+
+	// open circuit rejects calls without making them, other hosts are unaffected
+	_, err := testTool.GetJSON("http://down.example.com/items", nil)
+	if !errors.Is(err, ErrCircuitOpen) || calls != 2 {
+		t.Errorf("expected ErrCircuitOpen without a call but received %v after %d calls", err, calls)
+	}
+	if breaker.State("up.example.com") != CircuitClosed {
+		t.Error("circuit to another host should be closed")
+	}
+
+	// after cool down a failed trial call opens the circuit again
+	time.Sleep(25 * time.Millisecond)
+	if breaker.State("down.example.com") != CircuitHalfOpen {
+		t.Errorf("expected half-open circuit but it is %s", breaker.State("down.example.com"))
+	}
+	_, _ = testTool.GetJSON("http://down.example.com/items", nil)
+	if breaker.State("down.example.com") != CircuitOpen || calls != 3 {
+		t.Errorf("expected failed trial to open circuit but it is %s after %d calls", breaker.State("down.example.com"), calls)
+	}
+
+	// successful trial call closes the circuit
+	time.Sleep(25 * time.Millisecond)
+	status = http.StatusOK
+	_, err = testTool.GetJSON("http://down.example.com/items", nil)
+	if err != nil || breaker.State("down.example.com") != CircuitClosed {
+		t.Errorf("expected successful trial to close circuit but received %v, circuit %s", err, breaker.State("down.example.com"))
+	}
+
+	expectedChanges := []string{
+		"down.example.com closed > open",
+		"down.example.com open > half-open",
+		"down.example.com half-open > open",
+		"down.example.com open > half-open",
+		"down.example.com half-open > closed",
+	}
+	if len(changes) != len(expectedChanges) {
+		t.Fatalf("expected state changes %v but received %v", expectedChanges, changes)
+	}
+	for i := range changes {
+		if changes[i] != expectedChanges[i] {
+			t.Errorf("expected state change %q but received %q", expectedChanges[i], changes[i])
+		}
+	}
+}
+
+func TestTools_CircuitBreakerStopsRetries(t *testing.T) {
+	var requests []*http.Request
+	testTool := Tools{
+		HTTPClient:     sequenceClient([]int{503, 503, 503, 503}, nil, &requests),
+		RemoteRetry:    RetryPolicy{MaxAttempts: 4, BaseDelay: time.Millisecond},
+		CircuitBreaker: &CircuitBreaker{FailureThreshold: 2},
+	}
+
+	response, err := testTool.GetJSON("http://example.com", nil)
+	if len(requests) != 2 || response == nil || response.StatusCode != 503 || !errors.As(err, new(*RemoteError)) {
+		t.Errorf("expected retries to stop once circuit opened but made %d attempts (%v)", len(requests), err)
+	}
+}
@@ -0,0 +1,358 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// JSONRequest describes a request to a remote service made by DoJSON
+type JSONRequest struct {
+	Method string
+	URL    string
+	Header http.Header
+	// Body, if not nil, is sent encoded as JSON, or as NDJSON or a form depending on Encoding
+	Body     interface{}
+	Encoding RequestEncoding
+	// Gzip compresses the body, as does GzipRemoteRequests for every request
+	Gzip bool
+	// Target, if not nil, has a successful response body decoded into it
+	Target interface{}
+	// Timeout, if greater than zero, replaces RemoteTimeout as the time limit for this call
+	Timeout time.Duration
+}
+
+// RemoteResponse holds the response of a remote service; the body has already been read in full and closed
+type RemoteResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// RemoteError is returned when a remote service responds with a status other than 2xx. Message is taken from a
+// JSONResponse or problem details body if possible, otherwise it is the status text
+type RemoteError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Message    string
+	Header     http.Header
+	Body       []byte
+	Errors     []FieldError
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s %s: remote service responded %d: %s", e.Method, e.URL, e.StatusCode, e.Message)
+}
+
+// FieldErrors returns any individual field errors listed in the remote service's response
+func (e *RemoteError) FieldErrors() []FieldError {
+	return e.Errors
+}
+
+// GetJSON requests uri from a remote service and decodes the JSON response into target
+func (t *Tools) GetJSON(uri string, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.GetJSONContext(context.Background(), uri, target, headers...)
+}
+
+// GetJSONContext works just as GetJSON, the call being abandoned if ctx is done
+func (t *Tools) GetJSONContext(ctx context.Context, uri string, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodGet, URL: uri, Header: mergeHeaders(headers...), Target: target})
+}
+
+// PostJSON posts data as JSON to a remote service and decodes the JSON response into target (which may be nil)
+func (t *Tools) PostJSON(uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.PostJSONContext(context.Background(), uri, data, target, headers...)
+}
+
+// PostJSONContext works just as PostJSON, the call being abandoned if ctx is done
+func (t *Tools) PostJSONContext(ctx context.Context, uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodPost, URL: uri, Header: mergeHeaders(headers...), Body: data, Target: target})
+}
+
+// PutJSON puts data as JSON to a remote service and decodes the JSON response into target (which may be nil)
+func (t *Tools) PutJSON(uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.PutJSONContext(context.Background(), uri, data, target, headers...)
+}
+
+// PutJSONContext works just as PutJSON, the call being abandoned if ctx is done
+func (t *Tools) PutJSONContext(ctx context.Context, uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodPut, URL: uri, Header: mergeHeaders(headers...), Body: data, Target: target})
+}
+
+// PatchJSON patches a remote resource with data as JSON and decodes the JSON response into target (which may be nil)
+func (t *Tools) PatchJSON(uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.PatchJSONContext(context.Background(), uri, data, target, headers...)
+}
+
+// PatchJSONContext works just as PatchJSON, the call being abandoned if ctx is done
+func (t *Tools) PatchJSONContext(ctx context.Context, uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodPatch, URL: uri, Header: mergeHeaders(headers...), Body: data, Target: target})
+}
+
+// PostNDJSON posts items, a slice, to a remote service as NDJSON in batches of up to batchSize items (all
+// items in a single request if batchSize is not positive), returning the response to each batch. Nothing is posted if
+// there are no items, and posting stops at the first batch to fail
+func (t *Tools) PostNDJSON(uri string, items interface{}, batchSize int, headers ...http.Header) ([]*RemoteResponse, error) {
+	return t.PostNDJSONContext(context.Background(), uri, items, batchSize, headers...)
+}
+
+// PostNDJSONContext works just as PostNDJSON, posting being abandoned if ctx is done
+func (t *Tools) PostNDJSONContext(ctx context.Context, uri string, items interface{}, batchSize int, headers ...http.Header) ([]*RemoteResponse, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("NDJSON items must be a slice, not %T", items)
+	}
+	if batchSize <= 0 {
+		batchSize = v.Len()
+	}
+
+	var responses []*RemoteResponse
+	for start := 0; start < v.Len(); start += batchSize {
+		end := start + batchSize
+		if end > v.Len() {
+			end = v.Len()
+		}
+
+		req := JSONRequest{Method: http.MethodPost, URL: uri, Header: mergeHeaders(headers...), Body: v.Slice(start, end).Interface(), Encoding: EncodeNDJSON}
+		response, err := t.DoJSONContext(ctx, req)
+		if response != nil {
+			responses = append(responses, response)
+		}
+		if err != nil {
+			return responses, err
+		}
+	}
+
+	return responses, nil
+}
+
+// PostForm posts data, url.Values, a map or a struct (see ReadForm), to a remote service as a form and decodes the
+// JSON response into target (which may be nil)
+func (t *Tools) PostForm(uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.PostFormContext(context.Background(), uri, data, target, headers...)
+}
+
+// PostFormContext works just as PostForm, the call being abandoned if ctx is done
+func (t *Tools) PostFormContext(ctx context.Context, uri string, data, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodPost, URL: uri, Header: mergeHeaders(headers...), Body: data, Encoding: EncodeForm, Target: target})
+}
+
+// DeleteJSON deletes a remote resource and decodes any JSON response into target (which may be nil)
+func (t *Tools) DeleteJSON(uri string, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DeleteJSONContext(context.Background(), uri, target, headers...)
+}
+
+// DeleteJSONContext works just as DeleteJSON, the call being abandoned if ctx is done
+func (t *Tools) DeleteJSONContext(ctx context.Context, uri string, target interface{}, headers ...http.Header) (*RemoteResponse, error) {
+	return t.DoJSONContext(ctx, JSONRequest{Method: http.MethodDelete, URL: uri, Header: mergeHeaders(headers...), Target: target})
+}
+
+// DoJSON makes a request to a remote service using HTTPClient (default http.DefaultClient), sending the request body as
+// JSON and decoding a successful JSON response into the request target. The response is returned even when the
+// remote service responds with a status other than 2xx, in which case the error is a *RemoteError
+func (t *Tools) DoJSON(req JSONRequest) (*RemoteResponse, error) {
+	return t.DoJSONContext(context.Background(), req)
+}
+
+// DoJSONContext works just as DoJSON, the call being abandoned if ctx is done. Each call is limited to the request's
+// Timeout, else RemoteTimeout (default 30 seconds), and errors caused by running out of time or by ctx being cancelled
+// match ErrRemoteTimeout or ErrRemoteCanceled respectively. The time limit covers any retries made under RemoteRetry
+func (t *Tools) DoJSONContext(ctx context.Context, req JSONRequest) (*RemoteResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.remoteTimeout(req.Timeout))
+	defer cancel()
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	// encode & compress body, setting headers to match
+	header := make(http.Header)
+	header.Set("Accept", "application/json")
+
+	var body []byte
+	if req.Body != nil {
+		encoded, contentType, err := encodeRequestBody(req.Body, req.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		body = encoded
+		header.Set("Content-Type", contentType)
+
+		if req.Gzip || t.GzipRemoteRequests {
+			body, err = gzipRequestBody(body)
+			if err != nil {
+				return nil, err
+			}
+			header.Set("Content-Encoding", "gzip")
+		}
+	}
+	for key, values := range req.Header {
+		header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+	}
+
+	request, response, err := t.doRemote(ctx, t.httpClient(), method, req.URL, header, body)
+	if err != nil {
+		return nil, remoteCallError(ctx, err)
+	}
+
+	remote, err := t.readRemoteResponse(request, response, req.Target)
+	if err != nil && remote == nil {
+		return nil, remoteCallError(ctx, err)
+	}
+
+	return remote, err
+}
+
+// readRemoteResponse reads & closes the body of response, decoding it into target if successful
+func (t *Tools) readRemoteResponse(request *http.Request, response *http.Response, target interface{}) (*RemoteResponse, error) {
+	defer response.Body.Close()
+
+	body, err := readLimited(response.Body, t.remoteResponseLimit())
+	if err != nil {
+		return nil, err
+	}
+	remote := &RemoteResponse{StatusCode: response.StatusCode, Header: response.Header, Body: body}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return remote, newRemoteError(request, remote)
+	}
+
+	if target != nil && len(bytes.TrimSpace(body)) > 0 {
+		err = json.Unmarshal(body, target)
+		if err != nil {
+			return remote, fmt.Errorf("%s %s: error decoding response: %w", request.Method, request.URL.Redacted(), err)
+		}
+	}
+
+	return remote, nil
+}
+
+// newRemoteError builds a *RemoteError from an unsuccessful response, taking the message and any field errors from a
+// JSONResponse or problem details body
+func newRemoteError(request *http.Request, remote *RemoteResponse) *RemoteError {
+	remoteError := &RemoteError{
+		Method:     request.Method,
+		URL:        request.URL.Redacted(),
+		StatusCode: remote.StatusCode,
+		Message:    http.StatusText(remote.StatusCode),
+		Header:     remote.Header,
+		Body:       remote.Body,
+	}
+
+	var payload struct {
+		Message string       `json:"message"`
+		Detail  string       `json:"detail"`
+		Title   string       `json:"title"`
+		Errors  []FieldError `json:"errors"`
+	}
+	if json.Unmarshal(remote.Body, &payload) == nil {
+		for _, message := range []string{payload.Message, payload.Detail, payload.Title} {
+			if strings.TrimSpace(message) != "" {
+				remoteError.Message = message
+				break
+			}
+		}
+		remoteError.Errors = payload.Errors
+	}
+
+	return remoteError
+}
+
+// remoteResponseLimit returns the maximum size of a remote service's response body
+func (t *Tools) remoteResponseLimit() int64 {
+	if t.MaxRemoteResponseSize > 0 {
+		return t.MaxRemoteResponseSize
+	}
+
+	return 10 << 20
+}
+
+// remoteTimeout returns the time limit for a call to a remote service
+func (t *Tools) remoteTimeout(timeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	if t.RemoteTimeout > 0 {
+		return t.RemoteTimeout
+	}
+
+	return 30 * time.Second
+}
+
+// remoteContextError is returned when a call to a remote service fails because it timed out or was cancelled; it
+// matches ErrRemoteTimeout or ErrRemoteCanceled, as appropriate, as well as the underlying error
+type remoteContextError struct {
+	kind error
+	err  error
+}
+
+func (e *remoteContextError) Error() string {
+	return fmt.Sprintf("%s: %s", e.kind.Error(), e.err.Error())
+}
+
+func (e *remoteContextError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *remoteContextError) Unwrap() error {
+	return e.err
+}
+
+// remoteCallError identifies whether err, returned when calling a remote service, was caused by a timeout or by ctx
+// being cancelled
+func remoteCallError(ctx context.Context, err error) error {
+	var netError net.Error
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) ||
+		(errors.As(err, &netError) && netError.Timeout()):
+		return &remoteContextError{kind: ErrRemoteTimeout, err: err}
+	case errors.Is(err, context.Canceled) || errors.Is(ctx.Err(), context.Canceled):
+		return &remoteContextError{kind: ErrRemoteCanceled, err: err}
+	}
+
+	return err
+}
+
+// httpClient returns the client used to call remote services
+func (t *Tools) httpClient() *http.Client {
+	if t.HTTPClient != nil {
+		return t.wrapClient(t.HTTPClient)
+	}
+
+	return t.wrapClient(http.DefaultClient)
+}
+
+// wrapClient returns a copy of client whose transport is wrapped in RemoteMiddleware, or client itself if there is none
+func (t *Tools) wrapClient(client *http.Client) *http.Client {
+	if len(t.RemoteMiddleware) == 0 {
+		return client
+	}
+
+	wrapped := *client
+	wrapped.Transport = ChainTransport(client.Transport, t.RemoteMiddleware...)
+
+	return &wrapped
+}
+
+// mergeHeaders combines header sets into one, later values for a key being added to earlier ones
+func mergeHeaders(headers ...http.Header) http.Header {
+	merged := make(http.Header)
+	for _, header := range headers {
+		for key, values := range header {
+			for _, value := range values {
+				merged.Add(key, value)
+			}
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,262 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// incompressibleTypes are media types, or prefixes of them, whose content is already compressed
+var incompressibleTypes = []string{
+	"image/", "audio/", "video/", "font/woff",
+	"application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2", "application/x-xz",
+	"application/x-7z-compressed", "application/x-rar-compressed", "application/zstd", "application/pdf",
+}
+
+// WriteCompressedJSON works just as WriteJSON but compresses the response with gzip or deflate when the client accepts
+// it (see CompressResponses)
+func (t *Tools) WriteCompressedJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}, headers ...http.Header) error {
+	cw := t.compressWriter(w, r)
+	err := t.WriteJSON(cw, status, data, headers...)
+	if closeErr := cw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// CompressResponses is middleware which compresses responses with gzip or deflate, as negotiated from the request's
+// Accept-Encoding header. Responses smaller than CompressionMinSize (default 1024 bytes), partial content, those which
+// already have a Content-Encoding and those of already compressed media types (images, archives etc.) are sent as is.
+// 'Vary: Accept-Encoding' is added so that caches keep compressed and uncompressed responses apart
+func (t *Tools) CompressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cw := t.compressWriter(w, r)
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter returns a compressResponseWriter for w, using the encoding accepted by r
+func (t *Tools) compressWriter(w http.ResponseWriter, r *http.Request) *compressResponseWriter {
+	// set default minimum size if not set by user
+	minSize := 1024
+	if t.CompressionMinSize > 0 {
+		minSize = t.CompressionMinSize
+	}
+
+	return &compressResponseWriter{
+		ResponseWriter: w,
+		encoding:       negotiateEncoding(r.Header.Get("Accept-Encoding")),
+		minSize:        minSize,
+		head:           r.Method == http.MethodHead,
+		status:         http.StatusOK,
+	}
+}
+
+// compressResponseWriter buffers the start of a response until it knows whether it is large enough to be worth
+// compressing, then writes it either through a compressor or directly. Close must be called once the response is done
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding   string
+	minSize    int
+	head       bool
+	status     int
+	buf        []byte
+	decided    bool
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.decided {
+		return
+	}
+	// informational responses are passed straight through
+	if status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+
+	// responses without a body, or with part of one, are never compressed
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, p...)
+		if len(cw.buf) < cw.minSize {
+			return len(p), nil
+		}
+		// writing the buffer includes p
+		return len(p), cw.decide(true)
+	}
+
+	if cw.compressor != nil {
+		return cw.compressor.Write(p)
+	}
+
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends any buffered output to the client; a response flushed before reaching the minimum size is compressed
+// anyway, as it is being streamed
+func (cw *compressResponseWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide(len(cw.buf) > 0)
+	}
+	if cw.compressor != nil {
+		_ = cw.compressor.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+func (cw *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// Close writes any buffered output and finishes the compressed stream
+func (cw *compressResponseWriter) Close() error {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return err
+		}
+	}
+	if cw.compressor != nil {
+		return cw.compressor.Close()
+	}
+
+	return nil
+}
+
+// decide sends the response headers, compressing the response if compress is true and the response is eligible, then
+// writes the buffered output. A HEAD response may have no body to measure, so is given the headers of the equivalent
+// GET response according to its Content-Length, if set
+func (cw *compressResponseWriter) decide(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+
+	if cw.head {
+		size, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			size = len(cw.buf)
+		}
+		compress = size >= cw.minSize
+	}
+
+	if len(cw.buf) > 0 && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	excluded := cw.status == http.StatusNoContent || cw.status == http.StatusNotModified || cw.status == http.StatusPartialContent
+	if !excluded && header.Get("Content-Encoding") == "" && compressibleType(header.Get("Content-Type")) {
+		addVary(header, "Accept-Encoding")
+		if compress && cw.encoding != "" {
+			header.Set("Content-Encoding", cw.encoding)
+			header.Del("Content-Length")
+			switch {
+			case cw.head:
+				// no body is sent, so there is nothing to compress
+			case cw.encoding == "gzip":
+				cw.compressor = gzip.NewWriter(cw.ResponseWriter)
+			default:
+				cw.compressor = zlib.NewWriter(cw.ResponseWriter)
+			}
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.compressor != nil {
+		_, err = cw.compressor.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+
+	return err
+}
+
+// negotiateEncoding returns the preferred of gzip or deflate accepted by an Accept-Encoding header, or an empty string
+// if neither is acceptable
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[coding] = q
+	}
+
+	quality := func(coding string) float64 {
+		if q, ok := qualities[coding]; ok {
+			return q
+		}
+		return qualities["*"]
+	}
+
+	gzipQ, deflateQ := quality("gzip"), quality("deflate")
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip"
+	case deflateQ > 0:
+		return "deflate"
+	}
+
+	return ""
+}
+
+// compressibleType reports whether content of the given Content-Type is worth compressing
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// addVary adds value to the Vary header unless it is already listed
+func addVary(header http.Header, value string) {
+	for _, vary := range header.Values("Vary") {
+		for _, v := range strings.Split(vary, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), value) || strings.TrimSpace(v) == "*" {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
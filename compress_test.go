@@ -0,0 +1,163 @@
+package toolkit
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var negotiateEncodingTests = []struct {
+	acceptEncoding string
+	expected       string
+}{
+	{acceptEncoding: "", expected: ""},
+	{acceptEncoding: "gzip, deflate, br", expected: "gzip"},
+	{acceptEncoding: "deflate", expected: "deflate"},
+	{acceptEncoding: "gzip;q=0.5, deflate", expected: "deflate"},
+	{acceptEncoding: "gzip;q=0, deflate;q=0", expected: ""},
+	{acceptEncoding: "*", expected: "gzip"},
+	{acceptEncoding: "identity", expected: ""},
+}
+
+func TestTools_negotiateEncoding(t *testing.T) {
+	for _, e := range negotiateEncodingTests {
+		if encoding := negotiateEncoding(e.acceptEncoding); encoding != e.expected {
+			t.Errorf("%q: expected %q but received %q", e.acceptEncoding, e.expected, encoding)
+		}
+	}
+}
+
+func TestTools_WriteCompressedJSON(t *testing.T) {
+	var testTool Tools
+
+	large := strings.Repeat("compress me ", 200)
+
+	// large response is compressed with the accepted encoding
+	for _, encoding := range []string{"gzip", "deflate"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		rr := httptest.NewRecorder()
+
+		err := testTool.WriteCompressedJSON(rr, req, http.StatusOK, JSONResponse{Message: large})
+		if err != nil {
+			t.Fatal("error NOT expected but was generated:", err)
+		}
+
+		if rr.Header().Get("Content-Encoding") != encoding || rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: incorrect headers: %v", encoding, rr.Header())
+		}
+
+		var reader io.Reader
+		if encoding == "gzip" {
+			reader, err = gzip.NewReader(rr.Body)
+		} else {
+			reader, err = zlib.NewReader(rr.Body)
+		}
+		if err != nil {
+			t.Fatalf("%s: invalid compressed body: %s", encoding, err.Error())
+		}
+		body, _ := io.ReadAll(reader)
+		if !strings.Contains(string(body), large) {
+			t.Errorf("%s: incorrect decompressed body", encoding)
+		}
+	}
+
+	// small response, or client not accepting compression, is sent as is
+	for _, test := range []struct{ acceptEncoding, message string }{{"gzip", "small"}, {"", large}} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rr := httptest.NewRecorder()
+
+		_ = testTool.WriteCompressedJSON(rr, req, http.StatusAccepted, JSONResponse{Message: test.message})
+
+		if rr.Code != http.StatusAccepted || rr.Header().Get("Content-Encoding") != "" || !strings.Contains(rr.Body.String(), test.message) {
+			t.Errorf("expected uncompressed response but received %d %v", rr.Code, rr.Header())
+		}
+		if rr.Header().Get("Vary") != "Accept-Encoding" {
+			t.Error("expected Vary header on uncompressed response")
+		}
+	}
+}
+
+func TestTools_CompressResponses(t *testing.T) {
+	testTool := Tools{CompressionMinSize: 10}
+
+	handler := testTool.CompressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+	}))
+
+	var compressTests = []struct {
+		contentType string
+		compressed  bool
+	}{
+		{contentType: "text/plain; charset=utf-8", compressed: true},
+		{contentType: "image/svg+xml", compressed: true},
+		{contentType: "image/png", compressed: false},
+		{contentType: "application/zip", compressed: false},
+	}
+
+	for _, e := range compressTests {
+		req := httptest.NewRequest("GET", "/?type="+url.QueryEscape(e.contentType), nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if compressed := rr.Header().Get("Content-Encoding") == "gzip"; compressed != e.compressed {
+			t.Errorf("%s: expected compressed %t but received %t", e.contentType, e.compressed, compressed)
+		}
+	}
+}
+
+func TestTools_DownloadStaticFileCompressed(t *testing.T) {
+	testTool := Tools{CompressDownloads: true}
+
+	dir := t.TempDir()
+	text := strings.Repeat("some text\n", 500)
+	_ = os.WriteFile(filepath.Join(dir, "notes.txt"), []byte(text), 0644)
+	_ = os.WriteFile(filepath.Join(dir, "archive.zip"), []byte(text), 0644)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+
+	testTool.DownloadStaticFile(rr, req, dir, "notes.txt", "notes.txt")
+
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Content-Length") != "" {
+		t.Fatalf("expected compressed download but received %v", rr.Header())
+	}
+	reader, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatal("invalid compressed body:", err)
+	}
+	body, _ := io.ReadAll(reader)
+	if string(body) != text {
+		t.Error("incorrect decompressed download")
+	}
+
+	// HEAD request has the same headers as GET
+	headReq := httptest.NewRequest("HEAD", "/", nil)
+	headReq.Header.Set("Accept-Encoding", "gzip")
+	rr = httptest.NewRecorder()
+	testTool.DownloadStaticFile(rr, headReq, dir, "notes.txt", "notes.txt")
+
+	if rr.Header().Get("Content-Encoding") != "gzip" || rr.Header().Get("Content-Length") != "" || rr.Body.Len() != 0 {
+		t.Errorf("expected compressed HEAD response without a body but received %v, %d bytes", rr.Header(), rr.Body.Len())
+	}
+
+	// already compressed type is sent as is
+	rr = httptest.NewRecorder()
+	testTool.DownloadStaticFile(rr, req, dir, "archive.zip", "archive.zip")
+
+	if rr.Header().Get("Content-Encoding") != "" || rr.Body.String() != text {
+		t.Errorf("expected uncompressed download but received %v", rr.Header())
+	}
+}
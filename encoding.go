@@ -0,0 +1,253 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestEncoding determines how DoJSON encodes the body of a request to a remote service
+type RequestEncoding int
+
+const (
+	// EncodeJSON sends the body as a single JSON value
+	EncodeJSON RequestEncoding = iota
+	// EncodeNDJSON sends the body, a slice or array, as newline delimited JSON with one element per line
+	EncodeNDJSON
+	// EncodeForm sends the body, url.Values, a map or a struct, as an application/x-www-form-urlencoded form
+	EncodeForm
+)
+
+// encodeRequestBody encodes data as required by format, returning the body and its Content-Type
+func encodeRequestBody(data interface{}, format RequestEncoding) ([]byte, string, error) {
+	switch format {
+	case EncodeJSON:
+		body, err := json.Marshal(data)
+		return body, "application/json", err
+
+	case EncodeNDJSON:
+		v := reflect.ValueOf(data)
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return nil, "", fmt.Errorf("NDJSON request body must be a slice or array, not %T", data)
+		}
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		for i := 0; i < v.Len(); i++ {
+			// encoder terminates each value with a newline
+			if err := encoder.Encode(v.Index(i).Interface()); err != nil {
+				return nil, "", err
+			}
+		}
+		return body.Bytes(), "application/x-ndjson", nil
+
+	case EncodeForm:
+		values, err := encodeForm(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(values.Encode()), "application/x-www-form-urlencoded", nil
+	}
+
+	return nil, "", errors.New("unknown request encoding")
+}
+
+// gzipRequestBody compresses a request body
+func gzipRequestBody(body []byte) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(body); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return compressed.Bytes(), nil
+}
+
+// readLimited reads all of r, failing with ErrRemoteResponseTooLarge if it holds more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: maximum allowed size is %d bytes", ErrRemoteResponseTooLarge, limit)
+	}
+
+	return body, nil
+}
+
+// encodeForm converts url.Values, a map or a struct into form values. Structs are encoded just as ReadForm decodes
+// them: fields are named by their 'form' tag, else their 'json' tag, else their name, nested structs as 'address.city',
+// slices by repeating a key and slices of structs as 'items[0].sku'
+func encodeForm(data interface{}) (url.Values, error) {
+	switch form := data.(type) {
+	case url.Values:
+		return form, nil
+	case map[string][]string:
+		return form, nil
+	case map[string]string:
+		values := make(url.Values, len(form))
+		for key, value := range form {
+			values.Set(key, value)
+		}
+		return values, nil
+	}
+
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	values := make(url.Values)
+	switch {
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		iter := v.MapRange()
+		for iter.Next() {
+			err := encodeFormField(iter.Value(), iter.Key().String(), "", values)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	case v.Kind() == reflect.Struct:
+		err := encodeFormStruct(v, "", values)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("form request body must be url.Values, a map or a struct, not %T", data)
+	}
+
+	return values, nil
+}
+
+// encodeFormStruct adds each field of struct v to values, with keys beginning with prefix
+func encodeFormStruct(v reflect.Value, prefix string, values url.Values) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, ok := formFieldName(field)
+		if !ok {
+			continue
+		}
+
+		// fields of embedded structs without a name are promoted
+		fieldValue := v.Field(i)
+		formTag, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		jsonTag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && formTag == "" && jsonTag == "" {
+			embedded := indirectValue(fieldValue)
+			if embedded.Kind() == reflect.Struct {
+				err := encodeFormStruct(embedded, prefix, values)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		err := encodeFormField(fieldValue, prefix+name, field.Tag.Get("layout"), values)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeFormField adds v to values under key, descending into structs and slices. time.Time values are formatted with
+// layout, if not empty, else as RFC 3339
+func encodeFormField(v reflect.Value, key, layout string, values url.Values) error {
+	v = indirectValue(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	if isFormScalar(v.Type()) {
+		s, err := formValue(v, layout)
+		if err != nil {
+			return fmt.Errorf("error encoding form field %q: %w", key, err)
+		}
+		values.Add(key, s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return encodeFormStruct(v, key+".", values)
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			elemKey := key
+			if !isFormScalar(v.Type().Elem()) {
+				elemKey = fmt.Sprintf("%s[%d]", key, i)
+			}
+			err := encodeFormField(v.Index(i), elemKey, layout, values)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("error encoding form field %q: unsupported type %s", key, v.Type())
+}
+
+// formValue converts a scalar to its form representation
+func formValue(v reflect.Value, layout string) (string, error) {
+	if v.Type() == timeType {
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return v.Interface().(time.Time).Format(layout), nil
+	}
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+// indirectValue dereferences pointers & interfaces, returning the zero Value if any is nil
+func indirectValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
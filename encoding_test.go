@@ -0,0 +1,183 @@
+package toolkit
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type orderAddress struct {
+	City string `form:"city"`
+}
+
+type orderLine struct {
+	SKU string `json:"sku"`
+	Qty int    `json:"qty"`
+}
+
+type orderForm struct {
+	Name    string       `form:"name"`
+	Paid    bool         `json:"paid"`
+	Tags    []string     `form:"tag"`
+	Due     time.Time    `form:"due" layout:"2006-01-02"`
+	Address orderAddress `form:"address"`
+	Lines   []orderLine  `form:"items"`
+	Note    *string      `form:"note"`
+	Secret  string       `form:"-"`
+}
+
+var encodeRequestBodyTests = []struct {
+	name                string
+	data                interface{}
+	encoding            RequestEncoding
+	expectedBody        string
+	expectedContentType string
+	errorExpected       bool
+}{
+	{name: "json", data: map[string]int{"id": 7}, encoding: EncodeJSON, expectedBody: `{"id":7}`, expectedContentType: "application/json"},
+	{name: "ndjson", data: []map[string]int{{"id": 1}, {"id": 2}}, encoding: EncodeNDJSON, expectedBody: "{\"id\":1}\n{\"id\":2}\n", expectedContentType: "application/x-ndjson"},
+	{name: "ndjson not a slice", data: map[string]int{"id": 1}, encoding: EncodeNDJSON, errorExpected: true},
+	{name: "form values", data: url.Values{"a": {"1", "2"}}, encoding: EncodeForm, expectedBody: "a=1&a=2", expectedContentType: "application/x-www-form-urlencoded"},
+	{name: "form map", data: map[string]string{"b": "x y", "a": "1"}, encoding: EncodeForm, expectedBody: "a=1&b=x+y", expectedContentType: "application/x-www-form-urlencoded"},
+	{name: "form struct", data: &orderForm{
+		Name: "Jo", Paid: true, Tags: []string{"a", "b"}, Due: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		Address: orderAddress{City: "Leeds"}, Lines: []orderLine{{SKU: "x1", Qty: 2}}, Secret: "hidden",
+	}, encoding: EncodeForm,
+		expectedBody:        "address.city=Leeds&due=2024-03-01&items%5B0%5D.qty=2&items%5B0%5D.sku=x1&name=Jo&paid=true&tag=a&tag=b",
+		expectedContentType: "application/x-www-form-urlencoded"},
+	{name: "form unsupported", data: 7, encoding: EncodeForm, errorExpected: true},
+}
+
+func TestTools_EncodeRequestBody(t *testing.T) {
+	for _, e := range encodeRequestBodyTests {
+		body, contentType, err := encodeRequestBody(e.data, e.encoding)
+		if e.errorExpected {
+			if err == nil {
+				t.Errorf("%s: error expected but none received", e.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", e.name, err)
+			continue
+		}
+		if string(body) != e.expectedBody {
+			t.Errorf("%s: expected body %q but got %q", e.name, e.expectedBody, body)
+		}
+		if contentType != e.expectedContentType {
+			t.Errorf("%s: expected content type %q but got %q", e.name, e.expectedContentType, contentType)
+		}
+	}
+}
+
+func TestTools_EncodedRemoteRequests(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		requests = append(requests, req)
+		var body io.Reader = req.Body
+		if req.Header.Get("Content-Encoding") == "gzip" {
+			body, _ = gzip.NewReader(req.Body)
+		}
+		data, _ := io.ReadAll(body)
+		bodies = append(bodies, string(data))
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}
+	})
+
+	testTool := Tools{HTTPClient: client}
+
+	// NDJSON is sent in batches
+	items := []map[string]int{{"id": 1}, {"id": 2}, {"id": 3}}
+	responses, err := testTool.PostNDJSON("http://example.com/items", items, 2)
+	if err != nil {
+		t.Fatalf("unexpected error posting NDJSON: %v", err)
+	}
+	if len(responses) != 2 || len(bodies) != 2 {
+		t.Fatalf("expected 2 batches but got %d", len(bodies))
+	}
+	if bodies[0] != "{\"id\":1}\n{\"id\":2}\n" || bodies[1] != "{\"id\":3}\n" {
+		t.Errorf("unexpected NDJSON batches: %q", bodies)
+	}
+	if requests[0].Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Errorf("expected NDJSON content type but got %q", requests[0].Header.Get("Content-Type"))
+	}
+
+	// no items, no requests
+	requests, bodies = nil, nil
+	responses, err = testTool.PostNDJSON("http://example.com/items", []int{}, 2)
+	if err != nil || len(responses) != 0 || len(requests) != 0 {
+		t.Errorf("expected nothing to be posted for no items but got %d requests, error %v", len(requests), err)
+	}
+
+	// form, gzip compressed
+	requests, bodies = nil, nil
+	testTool.GzipRemoteRequests = true
+	_, err = testTool.PostForm("http://example.com/login", map[string]string{"user": "jo"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error posting form: %v", err)
+	}
+	if requests[0].Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		t.Errorf("expected form content type but got %q", requests[0].Header.Get("Content-Type"))
+	}
+	if requests[0].Header.Get("Content-Encoding") != "gzip" {
+		t.Errorf("expected gzip content encoding but got %q", requests[0].Header.Get("Content-Encoding"))
+	}
+	if bodies[0] != "user=jo" {
+		t.Errorf("expected form body %q but got %q", "user=jo", bodies[0])
+	}
+
+	// compression per request
+	requests, bodies = nil, nil
+	testTool.GzipRemoteRequests = false
+	_, err = testTool.DoJSON(JSONRequest{Method: http.MethodPost, URL: "http://example.com/items", Body: map[string]int{"id": 1}, Gzip: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requests[0].Header.Get("Content-Encoding") != "gzip" || bodies[0] != `{"id":1}` {
+		t.Errorf("expected gzip compressed JSON but got %q encoded %q", requests[0].Header.Get("Content-Encoding"), bodies[0])
+	}
+
+	// PushJSONToRemoteService compresses too
+	requests, bodies = nil, nil
+	testTool.GzipRemoteRequests = true
+	_, _, err = testTool.PushJSONToRemoteService("http://example.com/push", map[string]int{"id": 2}, client)
+	if err != nil {
+		t.Fatalf("unexpected error pushing: %v", err)
+	}
+	if requests[0].Header.Get("Content-Encoding") != "gzip" || bodies[0] != `{"id":2}` {
+		t.Errorf("expected gzip compressed push but got %q encoded %q", requests[0].Header.Get("Content-Encoding"), bodies[0])
+	}
+}
+
+func TestTools_MaxRemoteResponseSize(t *testing.T) {
+	client := NewTestClient(func(req *http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"name":"` + strings.Repeat("a", 100) + `"}`)),
+			Header:     make(http.Header),
+		}
+	})
+
+	testTool := Tools{HTTPClient: client, MaxRemoteResponseSize: 50}
+
+	_, err := testTool.GetJSON("http://example.com/items/7", nil)
+	if !errors.Is(err, ErrRemoteResponseTooLarge) {
+		t.Errorf("expected ErrRemoteResponseTooLarge but got %v", err)
+	}
+
+	_, _, err = testTool.PushJSONToRemoteService("http://example.com/push", map[string]int{"id": 2}, client)
+	if !errors.Is(err, ErrRemoteResponseTooLarge) {
+		t.Errorf("expected ErrRemoteResponseTooLarge from push but got %v", err)
+	}
+
+	testTool.MaxRemoteResponseSize = 0
+	if _, err = testTool.GetJSON("http://example.com/items/7", nil); err != nil {
+		t.Errorf("unexpected error with default limit: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Errors wrapped by a *JSONError when ReadJSON rejects a body under one of its strict decoding settings
+var (
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrNullValue    = errors.New("null value")
+	ErrTopLevelKind = errors.New("unexpected top level kind")
+)
+
+// ErrUnsupportedMediaType is wrapped by a *JSONError when a request body has an unacceptable Content-Type, charset or
+// Content-Encoding
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// Errors matched, using errors.Is, by the error returned when a call to a remote service runs out of time or is
+// cancelled by its context
+var (
+	ErrRemoteTimeout  = errors.New("remote service call timed out")
+	ErrRemoteCanceled = errors.New("remote service call cancelled")
+)
+
+// Errors wrapped by a *JSONError when VerifyWebhook rejects a request
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrExpiredWebhook   = errors.New("webhook timestamp outside tolerance")
+	ErrReplayedWebhook  = errors.New("webhook already received")
+)
+
+// ErrRemoteResponseTooLarge is matched by the error returned when a remote service's response body is larger than
+// MaxRemoteResponseSize
+var ErrRemoteResponseTooLarge = errors.New("remote service response too large")
+
+// ErrCircuitOpen is matched by the error returned when a call to a remote service is rejected by the CircuitBreaker
+var ErrCircuitOpen = errors.New("circuit open")
+
+// FieldError describes a problem with an individual field of a request body, identified by its JSON path
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Message
+}
+
+// FieldErrorer is implemented by errors which can list the individual fields they concern; ErrorJSON includes these
+// field errors in its response so that clients can identify the exact inputs at fault
+type FieldErrorer interface {
+	FieldErrors() []FieldError
+}
+
+// Codes used in FieldError to describe why a JSON request body could not be decoded
+const (
+	CodeSyntax               = "syntax"
+	CodeType                 = "type"
+	CodeUnknownField         = "unknown_field"
+	CodeEmptyBody            = "empty_body"
+	CodeBodyTooLarge         = "body_too_large"
+	CodeMultipleValues       = "multiple_values"
+	CodeInvalidTarget        = "invalid_target"
+	CodeDuplicateKey         = "duplicate_key"
+	CodeNullValue            = "null_value"
+	CodeTopLevelKind         = "top_level_kind"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidEncoding      = "invalid_encoding"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchFailed          = "patch_failed"
+	CodeInvalidSignature     = "invalid_signature"
+)
+
+// StatusCoder is implemented by errors which know the HTTP status code they should be reported with; ErrorJSON uses
+// this status code when none is supplied
+type StatusCoder interface {
+	StatusCode() int
+}
+
+// JSONError is returned by ReadJSON when a request body cannot be decoded. Field holds the JSON path of the field at
+// fault e.g. items[3].price, Line and Column its position within the body (when known) and Code one of the Code...
+// constants
+type JSONError struct {
+	Field   string
+	Code    string
+	Message string
+	Line    int
+	Column  int
+	Err     error
+}
+
+func (e *JSONError) Error() string {
+	return e.Message
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns 401 Unauthorized (for a webhook with an invalid signature), 413 Request Entity Too Large, 415
+// Unsupported Media Type or 422 Unprocessable Entity (for a patch which cannot be applied) where appropriate, else 400
+// Bad Request
+func (e *JSONError) StatusCode() int {
+	switch e.Code {
+	case CodeBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case CodePatchFailed:
+		return http.StatusUnprocessableEntity
+	case CodeInvalidSignature:
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusBadRequest
+}
+
+// FieldErrors returns the decoding problem as a single field error, or nil if the problem concerns the body as a whole
+// (e.g. an empty or over-large body) rather than any one field
+func (e *JSONError) FieldErrors() []FieldError {
+	if e.Field == "" {
+		return nil
+	}
+
+	return []FieldError{{Field: e.Field, Code: e.Code, Message: e.Message}}
+}
@@ -0,0 +1,369 @@
+package toolkit
+
+import (
+	"encoding"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// formTimeLayouts are tried in turn when decoding a time.Time field which has no 'layout' tag
+var formTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// ReadForm attempts to read an application/x-www-form-urlencoded or multipart/form-data request body and converts it
+// into data, a pointer to a struct (see ReadQuery for how values are matched to fields). The MaxJSONPayloadSize limit,
+// AllowUnknownFields and ValidateJSON settings apply just as for ReadJSON, and errors are reported as a *JSONError
+func (t *Tools) ReadForm(w http.ResponseWriter, r *http.Request, data interface{}) error {
+	maxBytes := t.jsonPayloadLimit()
+	// read request body
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+
+	var values url.Values
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(int64(maxBytes))
+		if err != nil {
+			return formParseError(err, maxBytes)
+		}
+		values = r.MultipartForm.Value
+	} else {
+		err := r.ParseForm()
+		if err != nil {
+			return formParseError(err, maxBytes)
+		}
+		values = r.PostForm
+	}
+
+	return t.decodeValues(values, data)
+}
+
+// ReadQuery converts the query string of a request into data, a pointer to a struct. Values are matched to fields by
+// their 'form' tag, else their 'json' tag, else their name. Nested struct fields are addressed as 'address.city', slices
+// by repeating a key ('tag=a&tag=b' or 'tag[]=a&tag[]=b') and slices of structs as 'items[0].sku'. Numbers, booleans,
+// time.Time (RFC 3339 or a 'layout' tag) and encoding.TextUnmarshaler fields are converted. The AllowUnknownFields and
+// ValidateJSON settings apply just as for ReadJSON, and errors are reported as a *JSONError
+func (t *Tools) ReadQuery(r *http.Request, data interface{}) error {
+	return t.decodeValues(r.URL.Query(), data)
+}
+
+// formParseError converts an error returned when parsing a form into a *JSONError
+func formParseError(err error, maxBytes int) error {
+	if strings.Contains(err.Error(), "request body too large") {
+		return &JSONError{Code: CodeBodyTooLarge, Message: fmt.Sprintf("maximum allowed request body size is %d bytes", maxBytes), Err: err}
+	}
+
+	return &JSONError{Code: CodeSyntax, Message: fmt.Sprintf("request body contains a badly formed form: %s", err.Error()), Err: err}
+}
+
+// decodeValues converts values into data, a pointer to a struct
+func (t *Tools) decodeValues(values url.Values, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return &JSONError{Code: CodeInvalidTarget, Message: "error decoding request: data must be a non-nil pointer to a struct"}
+	}
+
+	used := make(map[string]bool)
+	err := decodeFormStruct(v.Elem(), "", values, used)
+	if err != nil {
+		return err
+	}
+
+	// check values do not contain unknown fields, reporting the first in alphabetical order
+	if !t.AllowUnknownFields {
+		var unknown []string
+		for key := range values {
+			if !used[key] {
+				unknown = append(unknown, key)
+			}
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			return &JSONError{Field: unknown[0], Code: CodeUnknownField, Message: fmt.Sprintf("request contains unknown key %q", unknown[0])}
+		}
+	}
+
+	// check decoded data against its validation rules, identifying fields by their form names
+	if t.ValidateJSON {
+		return validate(data, formFieldName)
+	}
+
+	return nil
+}
+
+// decodeFormStruct sets each field of struct v from the values whose keys begin with prefix
+func decodeFormStruct(v reflect.Value, prefix string, values url.Values, used map[string]bool) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		// unexported fields are skipped unless embedded, as their exported fields are promoted
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		name, ok := formFieldName(field)
+		if !ok {
+			continue
+		}
+
+		// fields of embedded structs without a name are promoted
+		formTag, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		jsonTag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && formTag == "" && jsonTag == "" {
+			embedded := v.Field(i)
+			if embedded.Kind() == reflect.Pointer && embedded.Type().Elem().Kind() == reflect.Struct {
+				if !hasFormPrefix(values, prefix) || !embedded.CanSet() {
+					continue
+				}
+				if embedded.IsNil() {
+					embedded.Set(reflect.New(embedded.Type().Elem()))
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				err := decodeFormStruct(embedded, prefix, values, used)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		err := decodeFormField(v.Field(i), prefix+name, field.Tag.Get("layout"), values, used)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decodeFormField sets v from the values for key, or the values whose keys begin with key for structs and slices
+func decodeFormField(v reflect.Value, key, layout string, values url.Values, used map[string]bool) error {
+	t := v.Type()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case isFormScalar(t):
+		formValues, ok := values[key]
+		if !ok || len(formValues) == 0 {
+			return nil
+		}
+		used[key] = true
+		return setFormValue(v, key, formValues[0], layout)
+
+	case t.Kind() == reflect.Slice && isFormScalar(t.Elem()):
+		var formValues []string
+		formValues = append(formValues, values[key]...)
+		formValues = append(formValues, values[key+"[]"]...)
+		if len(formValues) == 0 {
+			return nil
+		}
+		used[key], used[key+"[]"] = true, true
+		slice := reflect.MakeSlice(t, len(formValues), len(formValues))
+		for i, s := range formValues {
+			err := setFormValue(slice.Index(i), fmt.Sprintf("%s[%d]", key, i), s, layout)
+			if err != nil {
+				return err
+			}
+		}
+		indirectForm(v).Set(slice)
+
+	case t.Kind() == reflect.Slice && indirectType(t.Elem()).Kind() == reflect.Struct:
+		indices := formIndices(values, key)
+		if len(indices) == 0 {
+			return nil
+		}
+		slice := reflect.MakeSlice(t, len(indices), len(indices))
+		for i, index := range indices {
+			elem := indirectForm(slice.Index(i))
+			err := decodeFormStruct(elem, fmt.Sprintf("%s[%d].", key, index), values, used)
+			if err != nil {
+				return err
+			}
+		}
+		indirectForm(v).Set(slice)
+
+	case t.Kind() == reflect.Struct:
+		if !hasFormPrefix(values, key+".") {
+			return nil
+		}
+		return decodeFormStruct(indirectForm(v), key+".", values, used)
+	}
+
+	return nil
+}
+
+// setFormValue converts s into the type of v, allocating pointers as necessary
+func setFormValue(v reflect.Value, key, s, layout string) error {
+	v = indirectForm(v)
+
+	invalid := func(kind string) error {
+		return &JSONError{Field: key, Code: CodeType, Message: fmt.Sprintf("request contains incorrect type for field %q: %q is not a valid %s", key, s, kind)}
+	}
+
+	if v.Type() == timeType {
+		layouts := formTimeLayouts
+		if layout != "" {
+			layouts = []string{layout}
+		}
+		for _, l := range layouts {
+			if parsed, err := time.Parse(l, s); err == nil {
+				v.Set(reflect.ValueOf(parsed))
+				return nil
+			}
+		}
+		return invalid("time")
+	}
+
+	if unmarshaler, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		if err := unmarshaler.UnmarshalText([]byte(s)); err != nil {
+			return invalid(v.Type().String())
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		// checkboxes are submitted as 'on' when ticked
+		if s == "on" {
+			v.SetBool(true)
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalid("boolean")
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalid("integer")
+		}
+		v.SetInt(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalid("unsigned integer")
+		}
+		v.SetUint(n)
+
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return invalid("number")
+		}
+		v.SetFloat(n)
+	}
+
+	return nil
+}
+
+// formFieldName returns the name used for field in forms & query strings, reporting false if the field is ignored
+func formFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("form")
+	if tag == "" {
+		return jsonFieldName(field)
+	}
+	if tag == "-" {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, true
+}
+
+// isFormScalar reports whether a value of type t is set from a single form value
+func isFormScalar(t reflect.Type) bool {
+	t = indirectType(t)
+	if t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+// indirectType dereferences pointer types
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// indirectForm dereferences v, allocating any nil pointers
+func indirectForm(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
+
+// hasFormPrefix reports whether any key of values begins with prefix
+func hasFormPrefix(values url.Values, prefix string) bool {
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// formIndices returns, in ascending order, the distinct indices used in keys of the form 'key[index].field'
+func formIndices(values url.Values, key string) []int {
+	seen := make(map[int]bool)
+	var indices []int
+	for k := range values {
+		rest := strings.TrimPrefix(k, key+"[")
+		if rest == k {
+			continue
+		}
+		end := strings.Index(rest, "].")
+		if end < 0 {
+			continue
+		}
+		index, err := strconv.Atoi(rest[:end])
+		if err != nil || index < 0 || seen[index] {
+			continue
+		}
+		seen[index] = true
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	return indices
+}
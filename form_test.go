@@ -0,0 +1,156 @@
+package toolkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type formAddress struct {
+	City     string `form:"city"`
+	Postcode string `form:"postcode" validate:"required"`
+}
+
+type formOrder struct {
+	Name      string       `form:"name" validate:"required"`
+	Quantity  int          `form:"qty"`
+	Price     *float64     `json:"price"`
+	Gift      bool         `form:"gift"`
+	Tags      []string     `form:"tag"`
+	IDs       []uint       `form:"id"`
+	Delivery  time.Time    `form:"delivery"`
+	Birthday  time.Time    `form:"birthday" layout:"02/01/2006"`
+	Address   formAddress  `form:"address"`
+	Billing   *formAddress `form:"billing"`
+	Items     []formItem   `form:"items"`
+	Ignored   string       `form:"-"`
+	Remainder string
+}
+
+type formItem struct {
+	SKU string `form:"sku"`
+	Qty int    `form:"qty"`
+}
+
+func TestTools_ReadQuery(t *testing.T) {
+	var testTool Tools
+
+	query := "name=joe&qty=3&price=9.5&gift=on&tag=a&tag=b&id[]=7&delivery=2023-08-07&birthday=25/12/1990" +
+		"&address.city=London&address.postcode=N1&items[1].sku=B&items[0].sku=A&items[0].qty=2&Remainder=x"
+	req := httptest.NewRequest("GET", "/?"+query, nil)
+
+	var order formOrder
+	err := testTool.ReadQuery(req, &order)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if order.Name != "joe" || order.Quantity != 3 || order.Price == nil || *order.Price != 9.5 || !order.Gift || order.Remainder != "x" {
+		t.Errorf("incorrect scalar fields decoded: %+v", order)
+	}
+
+	if len(order.Tags) != 2 || order.Tags[1] != "b" || len(order.IDs) != 1 || order.IDs[0] != 7 {
+		t.Errorf("incorrect slices decoded: %v %v", order.Tags, order.IDs)
+	}
+
+	if !order.Delivery.Equal(time.Date(2023, 8, 7, 0, 0, 0, 0, time.UTC)) || order.Birthday.Month() != time.December {
+		t.Errorf("incorrect times decoded: %v %v", order.Delivery, order.Birthday)
+	}
+
+	if order.Address.City != "London" || order.Billing != nil {
+		t.Errorf("incorrect nested structs decoded: %+v %+v", order.Address, order.Billing)
+	}
+
+	if len(order.Items) != 2 || order.Items[0].SKU != "A" || order.Items[0].Qty != 2 || order.Items[1].SKU != "B" {
+		t.Errorf("incorrect slice of structs decoded: %+v", order.Items)
+	}
+}
+
+var formErrorTests = []struct {
+	testName           string
+	query              string
+	allowUnknownFields bool
+	validate           bool
+	expectedCode       string
+	expectedField      string
+}{
+	{testName: "invalid integer", query: "qty=three", expectedCode: CodeType, expectedField: "qty"},
+	{testName: "invalid nested integer", query: "items[4].qty=x", expectedCode: CodeType, expectedField: "items[4].qty"},
+	{testName: "invalid boolean", query: "gift=maybe", expectedCode: CodeType, expectedField: "gift"},
+	{testName: "invalid time", query: "delivery=tomorrow", expectedCode: CodeType, expectedField: "delivery"},
+	{testName: "unknown field", query: "name=joe&colour=red", expectedCode: CodeUnknownField, expectedField: "colour"},
+	{testName: "ignored field", query: "Ignored=x", expectedCode: CodeUnknownField, expectedField: "Ignored"},
+	{testName: "allow unknown field", query: "name=joe&colour=red", allowUnknownFields: true},
+	{testName: "validation", query: "address.city=London", validate: true, expectedField: "name"},
+}
+
+func TestTools_ReadQueryErrors(t *testing.T) {
+	for _, test := range formErrorTests {
+		var testTool Tools
+		testTool.AllowUnknownFields = test.allowUnknownFields
+		testTool.ValidateJSON = test.validate
+
+		req := httptest.NewRequest("GET", "/?"+test.query, nil)
+
+		var order formOrder
+		err := testTool.ReadQuery(req, &order)
+
+		if test.expectedField == "" {
+			if err != nil {
+				t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			}
+			continue
+		}
+
+		if test.validate {
+			var validationErrors ValidationErrors
+			if !errors.As(err, &validationErrors) || validationErrors[0].Field != test.expectedField {
+				t.Errorf("%s: expected validation error for %s, received %v", test.testName, test.expectedField, err)
+			}
+			continue
+		}
+
+		var jsonError *JSONError
+		if !errors.As(err, &jsonError) {
+			t.Errorf("%s: JSONError expected but received %v", test.testName, err)
+			continue
+		}
+
+		if jsonError.Code != test.expectedCode || jsonError.Field != test.expectedField {
+			t.Errorf("%s: expected %s error for %q, received %s error for %q", test.testName, test.expectedCode, test.expectedField, jsonError.Code, jsonError.Field)
+		}
+	}
+}
+
+func TestTools_ReadForm(t *testing.T) {
+	var testTool Tools
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("name=joe&tag=a&tag=b&billing.postcode=E1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	var order formOrder
+	err := testTool.ReadForm(rr, req, &order)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if order.Name != "joe" || len(order.Tags) != 2 || order.Billing == nil || order.Billing.Postcode != "E1" {
+		t.Errorf("incorrect form decoded: %+v", order)
+	}
+
+	// body too large
+	testTool.MaxJSONPayloadSize = 8
+	req = httptest.NewRequest("POST", "/", strings.NewReader("name=joe&tag=a&tag=b"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	err = testTool.ReadForm(httptest.NewRecorder(), req, &order)
+
+	var jsonError *JSONError
+	if !errors.As(err, &jsonError) || jsonError.StatusCode() != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected body too large error but received %v", err)
+	}
+}
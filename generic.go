@@ -0,0 +1,58 @@
+package toolkit
+
+import "net/http"
+
+// TypedJSONResponse is a JSONResponse whose Data is of type T, so that handlers get compile-time checked payloads.
+// It is written as exactly the same JSON as a JSONResponse
+type TypedJSONResponse[T any] struct {
+	Error      bool         `json:"error"`
+	Message    string       `json:"message"`
+	Data       T            `json:"data,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	Pagination *PageMeta    `json:"pagination,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+}
+
+// ReadJSONAs reads the request body as JSON, just as ReadJSON, returning it as a value of type T
+func ReadJSONAs[T any](t *Tools, w http.ResponseWriter, r *http.Request) (T, error) {
+	var data T
+	err := t.ReadJSON(w, r, &data)
+
+	return data, err
+}
+
+// ReadJSONStreamAs reads a request body of NDJSON or concatenated JSON values, just as ReadJSONStream, passing each
+// value to fn as type T
+func ReadJSONStreamAs[T any](t *Tools, w http.ResponseWriter, r *http.Request, fn func(item T) error) error {
+	return t.ReadJSONStream(w, r, func() interface{} {
+		return new(T)
+	}, func(item interface{}) error {
+		return fn(*item.(*T))
+	})
+}
+
+// ReadFormAs reads the request body as a form, just as ReadForm, returning it as a value of type T
+func ReadFormAs[T any](t *Tools, w http.ResponseWriter, r *http.Request) (T, error) {
+	var data T
+	err := t.ReadForm(w, r, &data)
+
+	return data, err
+}
+
+// ReadQueryAs reads the request query string, just as ReadQuery, returning it as a value of type T
+func ReadQueryAs[T any](t *Tools, r *http.Request) (T, error) {
+	var data T
+	err := t.ReadQuery(r, &data)
+
+	return data, err
+}
+
+// WriteJSONAs writes a TypedJSONResponse holding message and data to the client, just as WriteJSON
+func WriteJSONAs[T any](t *Tools, w http.ResponseWriter, status int, message string, data T, headers ...http.Header) error {
+	payload := TypedJSONResponse[T]{
+		Message: message,
+		Data:    data,
+	}
+
+	return t.WriteJSON(w, status, payload, headers...)
+}
@@ -0,0 +1,98 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type genericPayload struct {
+	Foo string `json:"foo" form:"foo"`
+}
+
+func TestReadJSONAs(t *testing.T) {
+	var testTool Tools
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"foo": "bar"}`)))
+	rr := httptest.NewRecorder()
+
+	payload, err := ReadJSONAs[genericPayload](&testTool, rr, req)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if payload.Foo != "bar" {
+		t.Errorf("incorrect value decoded: %q", payload.Foo)
+	}
+
+	// errors are returned just as ReadJSON
+	req, _ = http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"foo": 1}`)))
+	_, err = ReadJSONAs[genericPayload](&testTool, rr, req)
+	if err == nil {
+		t.Error("error expected but NOT generated")
+	}
+}
+
+func TestReadJSONStreamAs(t *testing.T) {
+	var testTool Tools
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader("{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n"))
+
+	var received []string
+	err := ReadJSONStreamAs(&testTool, httptest.NewRecorder(), req, func(item genericPayload) error {
+		received = append(received, item.Foo)
+		return nil
+	})
+	if err != nil {
+		t.Error("error NOT expected but was generated:", err)
+	}
+
+	if strings.Join(received, ",") != "a,b" {
+		t.Errorf("incorrect items decoded: %v", received)
+	}
+}
+
+func TestReadFormAndQueryAs(t *testing.T) {
+	var testTool Tools
+
+	req := httptest.NewRequest("POST", "/?foo=query", strings.NewReader("foo=form"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	query, err := ReadQueryAs[genericPayload](&testTool, req)
+	if err != nil || query.Foo != "query" {
+		t.Errorf("incorrect query decoded: %+v %v", query, err)
+	}
+
+	form, err := ReadFormAs[genericPayload](&testTool, httptest.NewRecorder(), req)
+	if err != nil || form.Foo != "form" {
+		t.Errorf("incorrect form decoded: %+v %v", form, err)
+	}
+}
+
+func TestWriteJSONAs(t *testing.T) {
+	var testTool Tools
+
+	rr := httptest.NewRecorder()
+
+	err := WriteJSONAs(&testTool, rr, http.StatusCreated, "created", genericPayload{Foo: "bar"})
+	if err != nil {
+		t.Errorf("failed to write JSON: %v", err)
+	}
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("incorrect status code: %d", rr.Code)
+	}
+
+	var payload TypedJSONResponse[genericPayload]
+	err = json.NewDecoder(rr.Body).Decode(&payload)
+	if err != nil {
+		t.Error("received error when decoding JSON:", err)
+	}
+
+	if payload.Error || payload.Message != "created" || payload.Data.Foo != "bar" {
+		t.Errorf("incorrect response written: %+v", payload)
+	}
+}
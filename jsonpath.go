@@ -0,0 +1,470 @@
+package toolkit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// jsonNode describes a value, or an object key, found while walking a JSON document
+type jsonNode struct {
+	path  string
+	token json.Token
+	// key is true if the node is an object key, known is false if the key matches no field of the target struct
+	key   bool
+	known bool
+	// field is, for object keys, the name of the struct field the key decodes into (encoding/json matches names case
+	// insensitively), else the key itself
+	field string
+	// container identifies the object or array holding the node, 0 for top level values
+	container int
+	// typ is the Go type the value decodes into, or nil if this cannot be determined
+	typ reflect.Type
+	// start and end are the offsets of the first byte of the token and of the byte following it
+	start int64
+	end   int64
+}
+
+// jsonFrame tracks progress through an object or array while walking a JSON document
+type jsonFrame struct {
+	id        int
+	path      string
+	typ       reflect.Type
+	array     bool
+	index     int
+	expectKey bool
+	key       string
+	keyType   reflect.Type
+}
+
+// walkJSON passes every key and value in body, in document order, to visit until visit returns false. Values are
+// matched against target, the type being decoded into, so that each node knows the Go type it decodes into
+func walkJSON(body []byte, target reflect.Type, visit func(n jsonNode) bool) error {
+	decoded := json.NewDecoder(bytes.NewReader(body))
+	decoded.UseNumber()
+	var stack []*jsonFrame
+	frames := 0
+
+	for {
+		start := skipJSONSpace(body, decoded.InputOffset())
+		tok, err := decoded.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n := jsonNode{token: tok, start: start, end: decoded.InputOffset()}
+
+		// closing an object or array completes a value of its parent
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			if len(stack) > 0 {
+				stack[len(stack)-1].advance()
+			}
+			continue
+		}
+
+		var parent *jsonFrame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+			n.container = parent.id
+		}
+
+		// object keys
+		if parent != nil && parent.expectKey {
+			parent.key, _ = tok.(string)
+			parent.keyType, n.field, n.known = jsonChildType(parent.typ, parent.key)
+			parent.expectKey = false
+			n.key, n.path, n.typ = true, joinFieldPath(parent.path, parent.key), parent.keyType
+			if !visit(n) {
+				return nil
+			}
+			continue
+		}
+
+		// values
+		n.typ = target
+		if parent != nil && parent.array {
+			n.path, n.typ = fmt.Sprintf("%s[%d]", parent.path, parent.index), jsonElemType(parent.typ)
+		} else if parent != nil {
+			n.path, n.typ = joinFieldPath(parent.path, parent.key), parent.keyType
+		}
+		if !visit(n) {
+			return nil
+		}
+
+		if delim, ok := tok.(json.Delim); ok {
+			frames++
+			stack = append(stack, &jsonFrame{id: frames, path: n.path, typ: n.typ, array: delim == '[', expectKey: delim == '{'})
+		} else if parent != nil {
+			parent.advance()
+		}
+	}
+}
+
+// advance moves the frame on to its next array element or object key
+func (f *jsonFrame) advance() {
+	if f.array {
+		f.index++
+	} else {
+		f.expectKey = true
+	}
+}
+
+// skipJSONSpace returns the offset of the first byte at or after offset which is not whitespace or a separator
+func skipJSONSpace(body []byte, offset int64) int64 {
+	for offset < int64(len(body)) {
+		switch body[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+
+	return offset
+}
+
+// jsonIndirect dereferences pointer types, returning nil for types which are decoded by their own unmarshal method
+// or whose contents cannot be determined
+func jsonIndirect(t reflect.Type) reflect.Type {
+	for t != nil {
+		if t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType) ||
+			t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+			return nil
+		}
+		switch t.Kind() {
+		case reflect.Pointer:
+			t = t.Elem()
+		case reflect.Interface:
+			return nil
+		default:
+			return t
+		}
+	}
+
+	return nil
+}
+
+// jsonElemType returns the type of the elements of a slice or array type
+func jsonElemType(t reflect.Type) reflect.Type {
+	t = jsonIndirect(t)
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		return t.Elem()
+	}
+
+	return nil
+}
+
+// jsonChildType returns the type that the value of key decodes into and the name of the struct field it decodes into
+// (else key itself), reporting false if t is a struct without a matching field
+func jsonChildType(t reflect.Type, key string) (reflect.Type, string, bool) {
+	t = jsonIndirect(t)
+	if t == nil {
+		return nil, key, true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		typ, field, ok := jsonStructField(t, key)
+		if !ok {
+			return nil, key, false
+		}
+		return typ, field, true
+	case reflect.Map:
+		return t.Elem(), key, true
+	}
+
+	return nil, key, true
+}
+
+// jsonStructField finds the field of struct type t which encoding/json would decode key into, preferring an exact
+// match of the field name over a case-insensitive one, and returns its type & name
+func jsonStructField(t reflect.Type, key string) (reflect.Type, string, bool) {
+	var folded reflect.Type
+	var foldedName string
+	foundFolded := false
+
+	var search func(t reflect.Type, visited map[reflect.Type]bool) (reflect.Type, bool)
+	search = func(t reflect.Type, visited map[reflect.Type]bool) (reflect.Type, bool) {
+		if visited[t] {
+			return nil, false
+		}
+		visited[t] = true
+
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, ok := jsonFieldName(field)
+			if !ok {
+				continue
+			}
+
+			// fields of embedded structs without a JSON name are promoted
+			if tagName, _, _ := strings.Cut(field.Tag.Get("json"), ","); field.Anonymous && tagName == "" {
+				embedded := field.Type
+				if embedded.Kind() == reflect.Pointer {
+					embedded = embedded.Elem()
+				}
+				if embedded.Kind() == reflect.Struct {
+					if found, ok := search(embedded, visited); ok {
+						return found, true
+					}
+					continue
+				}
+			}
+			if !field.IsExported() {
+				continue
+			}
+
+			if name == key {
+				return field.Type, true
+			}
+			if !foundFolded && strings.EqualFold(name, key) {
+				folded, foldedName, foundFolded = field.Type, name, true
+			}
+		}
+
+		return nil, false
+	}
+
+	if found, ok := search(t, map[reflect.Type]bool{}); ok {
+		return found, key, true
+	}
+
+	return folded, foldedName, foundFolded
+}
+
+// jsonPosition converts an offset in body into a line and column number, both starting at 1
+func jsonPosition(body []byte, offset int64) (int, int) {
+	if offset > int64(len(body)) {
+		offset = int64(len(body))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	before := body[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+
+	return bytes.Count(before, []byte("\n")) + 1, utf8.RuneCount(before[lineStart:]) + 1
+}
+
+// locateJSONError adds the line, column & (except for syntax errors) JSON path at which a *JSONError occurred, found by
+// walking the body read so far, and rewrites its message to include them. Other errors are returned unchanged
+func locateJSONError(err error, body []byte, data interface{}) error {
+	var jsonError *JSONError
+	if !errors.As(err, &jsonError) {
+		return err
+	}
+
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+
+	var found jsonNode
+	located := false
+
+	// walk the body to the point of failure, remembering the last node visited or the node at fault
+	_ = walkJSON(body, reflect.TypeOf(data), func(n jsonNode) bool {
+		switch jsonError.Code {
+		case CodeType:
+			if !n.key && errors.As(jsonError.Err, &unmarshalTypeError) && n.end >= unmarshalTypeError.Offset {
+				found, located = n, true
+				return false
+			}
+		case CodeUnknownField:
+			if n.key && !n.known {
+				found, located = n, true
+				return false
+			}
+		}
+		found = n
+
+		return true
+	})
+
+	switch jsonError.Code {
+	case CodeSyntax:
+		offset := int64(len(body))
+		if errors.As(jsonError.Err, &syntaxError) {
+			offset = syntaxError.Offset - 1
+		}
+		// the line & column locate a syntax error; the last node parsed is not at fault so is not reported as the field
+		jsonError.Line, jsonError.Column = jsonPosition(body, offset)
+		if errors.Is(jsonError.Err, io.ErrUnexpectedEOF) {
+			jsonError.Message = fmt.Sprintf("request body contains badly formed JSON: unexpected end at line %d, column %d", jsonError.Line, jsonError.Column)
+		} else {
+			jsonError.Message = fmt.Sprintf("request body contains badly formed JSON at line %d, column %d", jsonError.Line, jsonError.Column)
+		}
+
+	case CodeType:
+		if !located {
+			return err
+		}
+		jsonError.Field = found.path
+		jsonError.Line, jsonError.Column = jsonPosition(body, found.start)
+		if found.path == "" {
+			jsonError.Message = fmt.Sprintf("request body contains incorrect JSON type at line %d, column %d", jsonError.Line, jsonError.Column)
+		} else {
+			jsonError.Message = fmt.Sprintf("request body contains incorrect JSON type for field %q at line %d, column %d", found.path, jsonError.Line, jsonError.Column)
+		}
+
+	case CodeUnknownField:
+		if !located {
+			return err
+		}
+		jsonError.Field = found.path
+		jsonError.Line, jsonError.Column = jsonPosition(body, found.start)
+		jsonError.Message = fmt.Sprintf("request body contains unknown key %q at line %d, column %d", found.path, jsonError.Line, jsonError.Column)
+	}
+
+	return err
+}
+
+// JSONKind identifies the kind of a JSON value, for use with RequireJSONKind
+type JSONKind int
+
+const (
+	// JSONKindAny accepts a value of any kind
+	JSONKindAny JSONKind = iota
+	JSONKindObject
+	JSONKindArray
+	JSONKindString
+	JSONKindNumber
+	JSONKindBoolean
+)
+
+func (k JSONKind) String() string {
+	switch k {
+	case JSONKindObject:
+		return "object"
+	case JSONKindArray:
+		return "array"
+	case JSONKindString:
+		return "string"
+	case JSONKindNumber:
+		return "number"
+	case JSONKindBoolean:
+		return "boolean"
+	}
+
+	return "value"
+}
+
+// jsonByteKind returns the kind of value which begins with byte b, or JSONKindAny for null and invalid values
+func jsonByteKind(b byte) JSONKind {
+	switch {
+	case b == '{':
+		return JSONKindObject
+	case b == '[':
+		return JSONKindArray
+	case b == '"':
+		return JSONKindString
+	case b == '-' || (b >= '0' && b <= '9'):
+		return JSONKindNumber
+	case b == 't' || b == 'f':
+		return JSONKindBoolean
+	}
+
+	return JSONKindAny
+}
+
+// checkJSONKind applies the RequireJSONKind setting to prefix, the start of a body up to and including the first byte
+// of its top level value
+func (t *Tools) checkJSONKind(prefix []byte) error {
+	if t.RequireJSONKind == JSONKindAny || len(prefix) == 0 || jsonByteKind(prefix[len(prefix)-1]) == t.RequireJSONKind {
+		return nil
+	}
+
+	problem := &JSONError{Code: CodeTopLevelKind, Err: ErrTopLevelKind}
+	problem.Line, problem.Column = jsonPosition(prefix, int64(len(prefix)-1))
+	problem.Message = fmt.Sprintf("request body must contain a JSON %s, found at line %d, column %d", t.RequireJSONKind, problem.Line, problem.Column)
+
+	return problem
+}
+
+// peekJSONValue returns, without consuming them, the bytes of r up to and including the first byte of a JSON value
+func peekJSONValue(r *bufio.Reader) []byte {
+	for n := 1; ; n++ {
+		prefix, err := r.Peek(n)
+		if err != nil {
+			return nil
+		}
+		switch prefix[n-1] {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return prefix
+	}
+}
+
+// jsonNullable reports whether a JSON null can be meaningfully decoded into a value of type t
+func jsonNullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+		return true
+	}
+
+	return t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType)
+}
+
+// checkStrictJSON applies the strict decoding settings DisallowDuplicateKeys and DisallowNullFields to body, a single JSON value which has already been decoded into data, returning a *JSONError locating the first
+// problem found
+func (t *Tools) checkStrictJSON(body []byte, data interface{}) error {
+	if !t.DisallowDuplicateKeys && !t.DisallowNullFields {
+		return nil
+	}
+
+	var problem *JSONError
+	var at jsonNode
+	keys := make(map[int]map[string]bool)
+
+	err := walkJSON(body, reflect.TypeOf(data), func(n jsonNode) bool {
+		at = n
+
+		switch {
+		case n.key && t.DisallowDuplicateKeys:
+			if keys[n.container] == nil {
+				keys[n.container] = make(map[string]bool)
+			}
+			// keys naming the same struct field in different cases are duplicates, as the last would silently win
+			if keys[n.container][n.field] {
+				problem = &JSONError{Field: n.path, Code: CodeDuplicateKey, Err: ErrDuplicateKey}
+			}
+			keys[n.container][n.field] = true
+
+		case !n.key && n.token == nil && t.DisallowNullFields && n.typ != nil && !jsonNullable(n.typ):
+			problem = &JSONError{Field: n.path, Code: CodeNullValue, Err: ErrNullValue}
+		}
+
+		return problem == nil
+	})
+	if err != nil {
+		return err
+	}
+	if problem == nil {
+		return nil
+	}
+
+	problem.Line, problem.Column = jsonPosition(body, at.start)
+	switch problem.Code {
+	case CodeDuplicateKey:
+		problem.Message = fmt.Sprintf("request body contains duplicate key %q at line %d, column %d", problem.Field, problem.Line, problem.Column)
+	case CodeNullValue:
+		problem.Message = fmt.Sprintf("request body contains null for field %q at line %d, column %d", problem.Field, problem.Line, problem.Column)
+	}
+
+	return problem
+}
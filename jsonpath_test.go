@@ -0,0 +1,142 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type jsonPathOrder struct {
+	Customer struct {
+		Name string `json:"name"`
+	} `json:"customer"`
+	Items []struct {
+		SKU   string  `json:"sku"`
+		Price float64 `json:"price"`
+	} `json:"items"`
+	Tags map[string]int `json:"tags"`
+}
+
+var jsonPathTests = []struct {
+	testName       string
+	json           string
+	expectedCode   string
+	expectedField  string
+	expectedLine   int
+	expectedColumn int
+}{
+	{testName: "nested type error", json: "{\n  \"items\": [\n    {\"sku\": \"a\", \"price\": 1},\n    {\"sku\": \"b\", \"price\": \"2\"}\n  ]\n}", expectedCode: CodeType, expectedField: "items[1].price", expectedLine: 4, expectedColumn: 27},
+	{testName: "object type error", json: `{"customer": {"name": {"first": "joe"}}}`, expectedCode: CodeType, expectedField: "customer.name", expectedLine: 1, expectedColumn: 23},
+	{testName: "map value type error", json: `{"tags": {"a": 1, "b": "two"}}`, expectedCode: CodeType, expectedField: "tags.b", expectedLine: 1, expectedColumn: 24},
+	{testName: "root type error", json: `[1, 2]`, expectedCode: CodeType, expectedField: "", expectedLine: 1, expectedColumn: 1},
+	{testName: "unknown nested field", json: "{\"customer\": {\"name\": \"joe\",\n \"age\": 3}}", expectedCode: CodeUnknownField, expectedField: "customer.age", expectedLine: 2, expectedColumn: 2},
+	{testName: "syntax error", json: "{\"items\": [\n  {\"sku\": }\n]}", expectedCode: CodeSyntax, expectedField: "", expectedLine: 2, expectedColumn: 11},
+	{testName: "unexpected end", json: "{\"customer\": {\"name\": \"joe\"", expectedCode: CodeSyntax, expectedField: "", expectedLine: 1, expectedColumn: 28},
+	{testName: "syntax error after valid field", json: `{"customer": {"name": "joe"},,}`, expectedCode: CodeSyntax, expectedField: "", expectedLine: 1, expectedColumn: 30},
+	{testName: "multi-byte characters", json: `{"customer": {"name": "Κόσμε"}, "items": 3}`, expectedCode: CodeType, expectedField: "items", expectedLine: 1, expectedColumn: 42},
+}
+
+func TestTools_ReadJSONErrorLocation(t *testing.T) {
+	var testTool Tools
+
+	for _, test := range jsonPathTests {
+		var decodedJSON jsonPathOrder
+
+		req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.json)))
+		rr := httptest.NewRecorder()
+
+		err := testTool.ReadJSON(rr, req, &decodedJSON)
+
+		var jsonError *JSONError
+		if !errors.As(err, &jsonError) {
+			t.Errorf("%s: JSONError expected but received %v", test.testName, err)
+			continue
+		}
+
+		if jsonError.Code != test.expectedCode || jsonError.Field != test.expectedField {
+			t.Errorf("%s: expected %s error for %q, received %s error for %q", test.testName, test.expectedCode, test.expectedField, jsonError.Code, jsonError.Field)
+		}
+
+		if jsonError.Line != test.expectedLine || jsonError.Column != test.expectedColumn {
+			t.Errorf("%s: expected line %d column %d, received line %d column %d (%s)", test.testName, test.expectedLine, test.expectedColumn, jsonError.Line, jsonError.Column, jsonError.Message)
+		}
+	}
+}
+
+var strictJSONTests = []struct {
+	testName      string
+	json          string
+	tool          Tools
+	expectedErr   error
+	expectedField string
+	expectedLine  int
+}{
+	{testName: "duplicate key allowed", json: `{"customer": {"name": "a", "name": "b"}}`, tool: Tools{}},
+	{testName: "duplicate key", json: "{\"customer\": {\"name\": \"a\",\n \"name\": \"b\"}}", tool: Tools{DisallowDuplicateKeys: true}, expectedErr: ErrDuplicateKey, expectedField: "customer.name", expectedLine: 2},
+	{testName: "duplicate key in different case", json: `{"customer": {"name": "a", "Name": "b"}}`, tool: Tools{DisallowDuplicateKeys: true}, expectedErr: ErrDuplicateKey, expectedField: "customer.Name", expectedLine: 1},
+	{testName: "map keys in different case", json: `{"tags": {"a": 1, "A": 2}}`, tool: Tools{DisallowDuplicateKeys: true}},
+	{testName: "same key in different objects", json: `{"items": [{"sku": "a"}, {"sku": "b"}]}`, tool: Tools{DisallowDuplicateKeys: true}},
+	{testName: "null allowed", json: `{"customer": {"name": null}}`, tool: Tools{}},
+	{testName: "null for string", json: `{"customer": {"name": null}}`, tool: Tools{DisallowNullFields: true}, expectedErr: ErrNullValue, expectedField: "customer.name", expectedLine: 1},
+	{testName: "null for struct", json: `{"customer": null}`, tool: Tools{DisallowNullFields: true}, expectedErr: ErrNullValue, expectedField: "customer", expectedLine: 1},
+	{testName: "null for slice and map", json: `{"items": null, "tags": null}`, tool: Tools{DisallowNullFields: true}},
+	{testName: "object required", json: `{"items": []}`, tool: Tools{RequireJSONKind: JSONKindObject}},
+	{testName: "array instead of object", json: `[]`, tool: Tools{RequireJSONKind: JSONKindObject, AllowUnknownFields: true}, expectedErr: ErrTopLevelKind, expectedLine: 1},
+}
+
+func TestTools_ReadJSONStrict(t *testing.T) {
+	for _, test := range strictJSONTests {
+		testTool := test.tool
+
+		var decodedJSON struct {
+			jsonPathOrder
+			Any interface{} `json:"any"`
+		}
+
+		req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(test.json)))
+		rr := httptest.NewRecorder()
+
+		err := testTool.ReadJSON(rr, req, &decodedJSON)
+		if test.expectedErr == nil {
+			if err != nil {
+				t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			}
+			continue
+		}
+
+		if !errors.Is(err, test.expectedErr) {
+			t.Errorf("%s: expected %v but received %v", test.testName, test.expectedErr, err)
+			continue
+		}
+
+		var jsonError *JSONError
+		if errors.As(err, &jsonError) && (jsonError.Field != test.expectedField || jsonError.Line != test.expectedLine) {
+			t.Errorf("%s: expected field %q on line %d, received field %q on line %d", test.testName, test.expectedField, test.expectedLine, jsonError.Field, jsonError.Line)
+		}
+	}
+}
+
+func TestTools_ReadJSONUseNumber(t *testing.T) {
+	var testTool Tools
+	testTool.UseJSONNumber = true
+
+	var decodedJSON struct {
+		Any interface{} `json:"any"`
+	}
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"any": 12345678901234567890}`)))
+	rr := httptest.NewRecorder()
+
+	err := testTool.ReadJSON(rr, req, &decodedJSON)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	number, ok := decodedJSON.Any.(json.Number)
+	if !ok || number.String() != "12345678901234567890" {
+		t.Errorf("expected json.Number 12345678901234567890, received %T %v", decodedJSON.Any, decodedJSON.Any)
+	}
+}
@@ -0,0 +1,107 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"unicode"
+)
+
+// Logger receives log records from Tools, with args given as alternating keys & values; it is satisfied by
+// *slog.Logger and may be adapted to any other structured logger
+type Logger interface {
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// requestIDKey is the context key under which RequestID stores the request ID
+type requestIDKey struct{}
+
+// RequestID is middleware which propagates a request, or correlation, ID. The ID is taken from the request's
+// RequestIDHeader (default X-Request-ID) if it is valid, otherwise one is generated. It is set on the response header,
+// from where ErrorJSON adds it to error responses, and is available to handlers through RequestIDFromContext
+func (t *Tools) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := t.requestIDHeader()
+
+		id := r.Header.Get(header)
+		if !validRequestID(id) {
+			id = t.newRequestID()
+		}
+
+		w.Header().Set(header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFromContext returns the request ID stored by RequestID, or an empty string if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
+
+// requestIDHeader returns the name of the header carrying request IDs
+func (t *Tools) requestIDHeader() string {
+	if t.RequestIDHeader != "" {
+		return t.RequestIDHeader
+	}
+
+	return "X-Request-ID"
+}
+
+// newRequestID returns a random request ID of 24 hex characters
+func (t *Tools) newRequestID() string {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return t.RandomString(24)
+	}
+
+	return hex.EncodeToString(id)
+}
+
+// validRequestID reports whether a client supplied request ID is safe to echo & log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c > unicode.MaxASCII || !unicode.IsPrint(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// reportError logs err, as sent with the given status, and returns the message to show the client along with the
+// response's request ID. Messages of 5xx errors are replaced by the status text unless ExposeInternalErrors is set, as
+// they may reveal internal details, so these are logged in full as errors while other errors are logged as info
+func (t *Tools) reportError(w http.ResponseWriter, err error, status int) (string, string) {
+	requestID := w.Header().Get(t.requestIDHeader())
+
+	if t.Logger != nil {
+		args := []interface{}{"status", status, "error", err.Error()}
+		if requestID != "" {
+			args = append(args, "request_id", requestID)
+		}
+		if status >= http.StatusInternalServerError {
+			t.Logger.Error("internal server error", args...)
+		} else {
+			t.Logger.Info("client error", args...)
+		}
+	}
+
+	if t.masksError(status) {
+		return http.StatusText(status), requestID
+	}
+
+	return err.Error(), requestID
+}
+
+// masksError reports whether the details of an error sent with the given status, its message & field errors, are
+// withheld from the client
+func (t *Tools) masksError(status int) bool {
+	return status >= http.StatusInternalServerError && !t.ExposeInternalErrors
+}
@@ -0,0 +1,109 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testLogger records every message logged, with its level and args
+type testLogger struct {
+	records []string
+}
+
+func (l *testLogger) Info(msg string, args ...interface{}) {
+	l.records = append(l.records, fmt.Sprint("INFO ", msg, args))
+}
+
+func (l *testLogger) Error(msg string, args ...interface{}) {
+	l.records = append(l.records, fmt.Sprint("ERROR ", msg, args))
+}
+
+func TestTools_RequestID(t *testing.T) {
+	var testTool Tools
+
+	var contextID string
+	handler := testTool.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contextID = RequestIDFromContext(r.Context())
+	}))
+
+	// valid ID is propagated
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if contextID != "abc-123" || rr.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("request ID not propagated: context %q, header %q", contextID, rr.Header().Get("X-Request-ID"))
+	}
+
+	// missing or invalid ID is replaced
+	for _, id := range []string{"", "bad\nid", strings.Repeat("x", 200)} {
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header["X-Request-Id"] = []string{id}
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if len(contextID) != 24 || rr.Header().Get("X-Request-ID") != contextID {
+			t.Errorf("%q: expected generated request ID but received %q", id, contextID)
+		}
+	}
+}
+
+func TestTools_ErrorJSONLogging(t *testing.T) {
+	for _, problemDetails := range []bool{false, true} {
+		logger := &testLogger{}
+		testTool := Tools{Logger: logger, UseProblemDetails: problemDetails}
+
+		// internal error is masked but logged in full, with the request ID
+		rr := httptest.NewRecorder()
+		rr.Header().Set("X-Request-ID", "req-1")
+		_ = testTool.ErrorJSON(rr, errors.New("database password is hunter2"), http.StatusInternalServerError)
+
+		var payload map[string]interface{}
+		_ = json.Unmarshal(rr.Body.Bytes(), &payload)
+		if strings.Contains(rr.Body.String(), "hunter2") || payload["request_id"] != "req-1" {
+			t.Errorf("problem details %t: incorrect internal error response: %s", problemDetails, rr.Body.String())
+		}
+		if len(logger.records) != 1 || !strings.HasPrefix(logger.records[0], "ERROR") ||
+			!strings.Contains(logger.records[0], "hunter2") || !strings.Contains(logger.records[0], "req-1") {
+			t.Errorf("problem details %t: incorrect log records: %v", problemDetails, logger.records)
+		}
+
+		// field errors of internal error are masked too
+		rr = httptest.NewRecorder()
+		_ = testTool.ErrorJSON(rr, &JSONError{Field: "db.password", Message: "secret internal"}, http.StatusInternalServerError)
+		if strings.Contains(rr.Body.String(), "secret internal") || strings.Contains(rr.Body.String(), "db.password") ||
+			strings.Contains(rr.Body.String(), `"errors"`) {
+			t.Errorf("problem details %t: internal field errors not masked: %s", problemDetails, rr.Body.String())
+		}
+
+		// client error is shown and logged as info
+		rr = httptest.NewRecorder()
+		_ = testTool.ErrorJSON(rr, errors.New("name is required"))
+		if !strings.Contains(rr.Body.String(), "name is required") || strings.Contains(rr.Body.String(), "request_id") {
+			t.Errorf("problem details %t: incorrect client error response: %s", problemDetails, rr.Body.String())
+		}
+		if len(logger.records) != 3 || !strings.HasPrefix(logger.records[2], "INFO") {
+			t.Errorf("problem details %t: incorrect log records: %v", problemDetails, logger.records)
+		}
+	}
+
+	// internal error is shown when exposed
+	testTool := Tools{ExposeInternalErrors: true}
+	rr := httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, errors.New("upstream timed out"), http.StatusBadGateway)
+	if !strings.Contains(rr.Body.String(), "upstream timed out") {
+		t.Errorf("expected exposed internal error but received %s", rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, &JSONError{Field: "db.password", Message: "secret internal"}, http.StatusInternalServerError)
+	if !strings.Contains(rr.Body.String(), `"field":"db.password"`) {
+		t.Errorf("expected exposed field errors but received %s", rr.Body.String())
+	}
+}
@@ -0,0 +1,187 @@
+package toolkit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Pagination holds the paging parameters of a request, as read by ReadPagination. Either Page or Cursor is in use;
+// Page is 0 when a cursor was supplied
+type Pagination struct {
+	Page    int
+	PerPage int
+	Cursor  string
+}
+
+// Offset returns the number of items preceding the requested page, limited to math.MaxInt
+func (p Pagination) Offset() int {
+	if p.Page < 1 || p.PerPage < 1 {
+		return 0
+	}
+	if p.Page-1 > math.MaxInt/p.PerPage {
+		return math.MaxInt
+	}
+
+	return (p.Page - 1) * p.PerPage
+}
+
+// PageMeta describes a page of results within a JSONResponse. Next and Prev hold the URLs of adjacent pages, which
+// WritePaginatedJSON also sends as RFC 8288 Link headers
+type PageMeta struct {
+	Page       int    `json:"page,omitempty"`
+	PerPage    int    `json:"per_page"`
+	Total      *int64 `json:"total,omitempty"`
+	TotalPages int    `json:"total_pages,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
+}
+
+// Meta returns the PageMeta for a page of results out of total items; a negative total means the total is unknown
+func (p Pagination) Meta(total int64) PageMeta {
+	meta := PageMeta{Page: p.Page, PerPage: p.PerPage}
+	if total >= 0 {
+		meta.Total = &total
+		if p.PerPage > 0 {
+			meta.TotalPages = int((total + int64(p.PerPage) - 1) / int64(p.PerPage))
+		}
+	}
+
+	return meta
+}
+
+// CursorMeta returns the PageMeta for a page of results retrieved by cursor, with the cursors of adjacent pages (empty
+// if there is no such page)
+func (p Pagination) CursorMeta(nextCursor, prevCursor string) PageMeta {
+	return PageMeta{PerPage: p.PerPage, NextCursor: nextCursor, PrevCursor: prevCursor}
+}
+
+// ReadPagination reads the 'page' & 'per_page', or 'cursor' & 'per_page', query parameters of a request. Page defaults
+// to 1 and per_page to DefaultPageSize (default 20); per_page is limited to MaxPageSize (default 100). Invalid values,
+// including pages so large that their offset cannot be represented, are reported as a *JSONError
+func (t *Tools) ReadPagination(r *http.Request) (Pagination, error) {
+	// set default page sizes if not set by user
+	perPage, maxPerPage := 20, 100
+	if t.DefaultPageSize > 0 {
+		perPage = t.DefaultPageSize
+	}
+	if t.MaxPageSize > 0 {
+		maxPerPage = t.MaxPageSize
+	}
+
+	query := r.URL.Query()
+	p := Pagination{Page: 1, PerPage: perPage, Cursor: query.Get("cursor")}
+
+	if s := query.Get("per_page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return p, &JSONError{Field: "per_page", Code: CodeType, Message: "per_page must be a positive integer"}
+		}
+		p.PerPage = n
+	}
+	if p.PerPage > maxPerPage {
+		p.PerPage = maxPerPage
+	}
+
+	if p.Cursor != "" {
+		p.Page = 0
+		return p, nil
+	}
+
+	if s := query.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return p, &JSONError{Field: "page", Code: CodeType, Message: "page must be a positive integer"}
+		}
+		if n-1 > math.MaxInt/p.PerPage {
+			return p, &JSONError{Field: "page", Code: CodeType, Message: "page is too large"}
+		}
+		p.Page = n
+	}
+
+	return p, nil
+}
+
+// WritePaginatedJSON writes data, a page of results, to the client as a JSONResponse together with meta. Unless already
+// set, meta.Next and meta.Prev are built from the request URL, and are sent along with 'first' and 'last' pages (when
+// the total is known) as Link headers. Without a total, a next page is assumed when data is a full page
+func (t *Tools) WritePaginatedJSON(w http.ResponseWriter, r *http.Request, status int, data interface{}, meta PageMeta, headers ...http.Header) error {
+	links := make(map[string]string)
+
+	if meta.Page > 0 {
+		hasNext := meta.Total != nil && meta.Page < meta.TotalPages
+		if meta.Total == nil {
+			v := reflect.ValueOf(data)
+			hasNext = v.Kind() == reflect.Slice && v.Len() >= meta.PerPage
+		}
+		if hasNext && meta.Page < math.MaxInt {
+			links["next"] = pageURL(r.URL, "page", strconv.Itoa(meta.Page+1), meta.PerPage)
+		}
+		if meta.Page > 1 {
+			links["prev"] = pageURL(r.URL, "page", strconv.Itoa(meta.Page-1), meta.PerPage)
+		}
+		if meta.Total != nil {
+			links["first"] = pageURL(r.URL, "page", "1", meta.PerPage)
+			links["last"] = pageURL(r.URL, "page", strconv.Itoa(maxInt(meta.TotalPages, 1)), meta.PerPage)
+		}
+	} else {
+		if meta.NextCursor != "" {
+			links["next"] = pageURL(r.URL, "cursor", meta.NextCursor, meta.PerPage)
+		}
+		if meta.PrevCursor != "" {
+			links["prev"] = pageURL(r.URL, "cursor", meta.PrevCursor, meta.PerPage)
+		}
+	}
+
+	if meta.Next == "" {
+		meta.Next = links["next"]
+	}
+	if meta.Prev == "" {
+		meta.Prev = links["prev"]
+	}
+	links["next"], links["prev"] = meta.Next, meta.Prev
+
+	var linkValues []string
+	for _, rel := range []string{"first", "prev", "next", "last"} {
+		if links[rel] != "" {
+			linkValues = append(linkValues, fmt.Sprintf("<%s>; rel=\"%s\"", links[rel], rel))
+		}
+	}
+	if len(linkValues) > 0 {
+		w.Header().Set("Link", strings.Join(linkValues, ", "))
+	}
+
+	payload := JSONResponse{
+		Data:       data,
+		Pagination: &meta,
+	}
+
+	return t.WriteJSON(w, status, payload, headers...)
+}
+
+// pageURL returns the path & query of u with param set to value and per_page set to perPage; the cursor and page
+// parameters are mutually exclusive so the other one is removed
+func pageURL(u *url.URL, param, value string, perPage int) string {
+	query := u.Query()
+	query.Del("page")
+	query.Del("cursor")
+	query.Set(param, value)
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	return (&url.URL{Path: u.Path, RawQuery: query.Encode()}).String()
+}
+
+// maxInt returns the larger of a and b
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,112 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var paginationTests = []struct {
+	testName       string
+	query          string
+	maxPageSize    int
+	expected       Pagination
+	expectedOffset int
+	expectedField  string
+}{
+	{testName: "defaults", query: "", expected: Pagination{Page: 1, PerPage: 20}},
+	{testName: "page", query: "page=3&per_page=10", expected: Pagination{Page: 3, PerPage: 10}, expectedOffset: 20},
+	{testName: "per page limited", query: "per_page=500", expected: Pagination{Page: 1, PerPage: 100}},
+	{testName: "custom limit", query: "per_page=50", maxPageSize: 25, expected: Pagination{Page: 1, PerPage: 25}},
+	{testName: "cursor", query: "cursor=abc&per_page=5", expected: Pagination{PerPage: 5, Cursor: "abc"}},
+	{testName: "invalid page", query: "page=0", expectedField: "page"},
+	{testName: "invalid per page", query: "per_page=ten", expectedField: "per_page"},
+	{testName: "page offset overflows", query: "page=9223372036854775807&per_page=50", expectedField: "page"},
+}
+
+func TestTools_ReadPagination(t *testing.T) {
+	for _, e := range paginationTests {
+		testTool := Tools{MaxPageSize: e.maxPageSize}
+		req := httptest.NewRequest("GET", "/items?"+e.query, nil)
+
+		p, err := testTool.ReadPagination(req)
+
+		if e.expectedField != "" {
+			var jsonError *JSONError
+			if !errors.As(err, &jsonError) || jsonError.Field != e.expectedField {
+				t.Errorf("%s: expected error for field %q but received %v", e.testName, e.expectedField, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error NOT expected but was generated: %s", e.testName, err.Error())
+			continue
+		}
+
+		if p != e.expected || p.Offset() != e.expectedOffset {
+			t.Errorf("%s: expected %+v (offset %d) but received %+v (offset %d)", e.testName, e.expected, e.expectedOffset, p, p.Offset())
+		}
+	}
+}
+
+func TestTools_PaginationOverflow(t *testing.T) {
+	var testTool Tools
+
+	p := Pagination{Page: math.MaxInt, PerPage: 50}
+	if p.Offset() != math.MaxInt {
+		t.Errorf("expected offset to be limited to %d but received %d", math.MaxInt, p.Offset())
+	}
+
+	// no next page beyond the largest page
+	req := httptest.NewRequest("GET", "/items", nil)
+	rr := httptest.NewRecorder()
+	_ = testTool.WritePaginatedJSON(rr, req, 200, []int{1}, PageMeta{Page: math.MaxInt, PerPage: 1})
+	if link := rr.Header().Get("Link"); strings.Contains(link, `rel="next"`) {
+		t.Errorf("unexpected next link: %s", link)
+	}
+}
+
+func TestTools_WritePaginatedJSON(t *testing.T) {
+	var testTool Tools
+
+	req := httptest.NewRequest("GET", "/items?page=2&per_page=10&sort=name", nil)
+	p, _ := testTool.ReadPagination(req)
+	rr := httptest.NewRecorder()
+
+	err := testTool.WritePaginatedJSON(rr, req, 200, []int{11, 12, 13}, p.Meta(35))
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	expectedLink := `</items?page=1&per_page=10&sort=name>; rel="first", </items?page=1&per_page=10&sort=name>; rel="prev", ` +
+		`</items?page=3&per_page=10&sort=name>; rel="next", </items?page=4&per_page=10&sort=name>; rel="last"`
+	if link := rr.Header().Get("Link"); link != expectedLink {
+		t.Errorf("incorrect Link header: %s", link)
+	}
+
+	var response JSONResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	meta := response.Pagination
+	if meta == nil || meta.Page != 2 || meta.Total == nil || *meta.Total != 35 || meta.TotalPages != 4 || meta.Next != "/items?page=3&per_page=10&sort=name" {
+		t.Errorf("incorrect pagination metadata: %+v", meta)
+	}
+
+	// cursor pagination, on the last page
+	req = httptest.NewRequest("GET", "/items?cursor=b&per_page=2", nil)
+	p, _ = testTool.ReadPagination(req)
+	rr = httptest.NewRecorder()
+
+	_ = testTool.WritePaginatedJSON(rr, req, 200, []int{3}, p.CursorMeta("", "a"))
+	if link := rr.Header().Get("Link"); link != `</items?cursor=a&per_page=2>; rel="prev"` {
+		t.Errorf("incorrect cursor Link header: %s", link)
+	}
+
+	response = JSONResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &response)
+	if response.Pagination == nil || response.Pagination.Total != nil || response.Pagination.Next != "" || response.Pagination.PrevCursor != "a" {
+		t.Errorf("incorrect cursor pagination metadata: %+v", response.Pagination)
+	}
+}
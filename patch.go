@@ -0,0 +1,537 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ReadJSONPatch reads an RFC 6902 JSON Patch document from the request body, subject to the same size limit, content
+// type and decompression handling as ReadJSON, and applies it to target. Target is either a *json.RawMessage or *[]byte
+// holding a JSON document, or a pointer to any other value (typically a struct) which is patched via its JSON form.
+// Patched values are decoded afresh, so fields not represented in JSON are reset, and must satisfy AllowUnknownFields
+// and, if ValidateJSON is set, their validation rules; target is left unchanged if the patch cannot be applied
+func (t *Tools) ReadJSONPatch(w http.ResponseWriter, r *http.Request, target interface{}) error {
+	patch, err := t.readJSONDocument(w, r)
+	if err != nil {
+		return err
+	}
+
+	return t.patchTarget(target, func(doc interface{}) (interface{}, error) {
+		return applyJSONPatch(doc, patch)
+	})
+}
+
+// ReadMergePatch reads an RFC 7396 JSON Merge Patch document from the request body and applies it to target, just as
+// ReadJSONPatch does for a JSON Patch
+func (t *Tools) ReadMergePatch(w http.ResponseWriter, r *http.Request, target interface{}) error {
+	patch, err := t.readJSONDocument(w, r)
+	if err != nil {
+		return err
+	}
+
+	return t.patchTarget(target, func(doc interface{}) (interface{}, error) {
+		return applyMergePatch(doc, patch), nil
+	})
+}
+
+// ApplyJSONPatch applies an RFC 6902 JSON Patch to a JSON document, returning the patched document
+func (t *Tools) ApplyJSONPatch(doc, patch []byte) ([]byte, error) {
+	parsedPatch, err := parseJSONDocument(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.patchDocument(doc, func(parsed interface{}) (interface{}, error) {
+		return applyJSONPatch(parsed, parsedPatch)
+	})
+}
+
+// ApplyMergePatch applies an RFC 7396 JSON Merge Patch to a JSON document, returning the patched document
+func (t *Tools) ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	parsedPatch, err := parseJSONDocument(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.patchDocument(doc, func(parsed interface{}) (interface{}, error) {
+		return applyMergePatch(parsed, parsedPatch), nil
+	})
+}
+
+// readJSONDocument reads a single JSON value of any kind from the request body, keeping numbers as json.Number
+func (t *Tools) readJSONDocument(w http.ResponseWriter, r *http.Request) (interface{}, error) {
+	maxBytes := t.jsonPayloadLimit()
+	requestBody, err := t.jsonRequestBody(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(requestBody)
+	if err != nil {
+		return nil, jsonDecodeError(err, maxBytes)
+	}
+
+	var doc interface{}
+	decoded := json.NewDecoder(bytes.NewReader(body))
+	decoded.UseNumber()
+	err = decoded.Decode(&doc)
+	if err != nil {
+		return nil, locateJSONError(jsonDecodeError(err, maxBytes), body, &doc)
+	}
+	err = checkJSONEnd(decoded, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, nil
+}
+
+// parseJSONDocument parses a JSON document, keeping numbers as json.Number
+func parseJSONDocument(data []byte) (interface{}, error) {
+	var doc interface{}
+	decoded := json.NewDecoder(bytes.NewReader(data))
+	decoded.UseNumber()
+	err := decoded.Decode(&doc)
+	if err != nil {
+		return nil, locateJSONError(jsonDecodeError(err, len(data)), data, &doc)
+	}
+
+	return doc, nil
+}
+
+// patchDocument parses doc, applies patch to it and returns the result as JSON
+func (t *Tools) patchDocument(doc []byte, patch func(doc interface{}) (interface{}, error)) ([]byte, error) {
+	parsed, err := parseJSONDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := patch(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(patched)
+}
+
+// patchTarget applies patch to the JSON form of target, then decodes the result back into target
+func (t *Tools) patchTarget(target interface{}, patch func(doc interface{}) (interface{}, error)) error {
+	switch document := target.(type) {
+	case *json.RawMessage:
+		patched, err := t.patchDocument(*document, patch)
+		if err != nil {
+			return err
+		}
+		*document = patched
+		return nil
+
+	case *[]byte:
+		patched, err := t.patchDocument(*document, patch)
+		if err != nil {
+			return err
+		}
+		*document = patched
+		return nil
+	}
+
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return &JSONError{Code: CodeInvalidTarget, Message: "error applying patch: target must be a non-nil pointer"}
+	}
+
+	current, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+	patched, err := t.patchDocument(current, patch)
+	if err != nil {
+		return err
+	}
+
+	// decode patched document into a new value, only replacing target once it is known to be valid
+	result := reflect.New(v.Elem().Type())
+	decoded := json.NewDecoder(bytes.NewReader(patched))
+	if !t.AllowUnknownFields {
+		decoded.DisallowUnknownFields()
+	}
+	if t.UseJSONNumber {
+		decoded.UseNumber()
+	}
+	err = decoded.Decode(result.Interface())
+	if err != nil {
+		err = locateJSONError(jsonDecodeError(err, len(patched)), patched, result.Interface())
+		if jsonError, ok := err.(*JSONError); ok {
+			jsonError.Code, jsonError.Line, jsonError.Column = CodePatchFailed, 0, 0
+			jsonError.Message = "patch produces an invalid document"
+			if jsonError.Field != "" {
+				jsonError.Message = fmt.Sprintf("patch produces an invalid value for field %q", jsonError.Field)
+			}
+		}
+		return err
+	}
+
+	if t.ValidateJSON {
+		err = t.Validate(result.Interface())
+		if err != nil {
+			return err
+		}
+	}
+
+	v.Elem().Set(result.Elem())
+
+	return nil
+}
+
+// applyMergePatch applies an RFC 7396 merge patch to doc
+func applyMergePatch(doc, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docObject, ok := doc.(map[string]interface{})
+	if !ok {
+		docObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(docObject, key)
+		} else {
+			docObject[key] = applyMergePatch(docObject[key], value)
+		}
+	}
+
+	return docObject
+}
+
+// applyJSONPatch applies each operation of an RFC 6902 patch to doc in turn
+func applyJSONPatch(doc, patch interface{}) (interface{}, error) {
+	operations, ok := patch.([]interface{})
+	if !ok {
+		return nil, &JSONError{Code: CodeInvalidPatch, Message: "JSON patch must be an array of operations"}
+	}
+
+	for i, operation := range operations {
+		var err error
+		doc, err = applyJSONPatchOperation(doc, operation)
+		if err != nil {
+			field := fmt.Sprintf("[%d]", i)
+			if jsonError, ok := err.(*JSONError); ok {
+				jsonError.Field = field
+				jsonError.Message = fmt.Sprintf("JSON patch operation %d: %s", i, jsonError.Message)
+				return nil, jsonError
+			}
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// applyJSONPatchOperation applies a single JSON patch operation to doc
+func applyJSONPatchOperation(doc, operation interface{}) (interface{}, error) {
+	members, ok := operation.(map[string]interface{})
+	if !ok {
+		return nil, invalidPatch("operation must be an object")
+	}
+
+	op, _ := members["op"].(string)
+	path, ok := members["path"].(string)
+	if !ok {
+		return nil, invalidPatch("operation must have a string 'path' member")
+	}
+	tokens, err := parseJSONPointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value, hasValue := members["value"]
+
+	switch op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return nil, invalidPatch(fmt.Sprintf("%s operation must have a 'value' member", op))
+		}
+		if op == "test" {
+			current, err := jsonPointerGet(doc, tokens)
+			if err != nil {
+				return nil, err
+			}
+			if !jsonEqual(current, value) {
+				return nil, failedPatch(fmt.Sprintf("test failed, value at %q does not match", path))
+			}
+			return doc, nil
+		}
+		return jsonPointerSet(doc, tokens, op, value)
+
+	case "remove":
+		if len(tokens) == 0 {
+			return nil, failedPatch("cannot remove the whole document")
+		}
+		doc, _, err = jsonPointerRemove(doc, tokens)
+		return doc, err
+
+	case "move", "copy":
+		from, ok := members["from"].(string)
+		if !ok {
+			return nil, invalidPatch(fmt.Sprintf("%s operation must have a string 'from' member", op))
+		}
+		fromTokens, err := parseJSONPointer(from)
+		if err != nil {
+			return nil, err
+		}
+
+		var moved interface{}
+		if op == "copy" {
+			moved, err = jsonPointerGet(doc, fromTokens)
+			if err != nil {
+				return nil, err
+			}
+			moved = jsonCopy(moved)
+		} else {
+			if path == from {
+				return doc, nil
+			}
+			if strings.HasPrefix(path, from+"/") {
+				return nil, failedPatch(fmt.Sprintf("cannot move %q into one of its own children", from))
+			}
+			if len(fromTokens) == 0 {
+				return nil, failedPatch("cannot move the whole document")
+			}
+			doc, moved, err = jsonPointerRemove(doc, fromTokens)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return jsonPointerSet(doc, tokens, "add", moved)
+	}
+
+	return nil, invalidPatch(fmt.Sprintf("unknown operation %q", op))
+}
+
+// invalidPatch reports a malformed JSON patch
+func invalidPatch(message string) error {
+	return &JSONError{Code: CodeInvalidPatch, Message: message}
+}
+
+// failedPatch reports a JSON patch which cannot be applied to the document
+func failedPatch(message string) error {
+	return &JSONError{Code: CodePatchFailed, Message: message}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON pointer into its unescaped reference tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, invalidPatch(fmt.Sprintf("invalid JSON pointer %q", pointer))
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+// jsonArrayIndex converts a reference token into an index of an array of length n, allowing n itself if allowEnd is set
+func jsonArrayIndex(token string, n int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return n, nil
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') || index > n || (index == n && !allowEnd) {
+		return 0, failedPatch(fmt.Sprintf("array index %q is out of range", token))
+	}
+
+	return index, nil
+}
+
+// jsonPointerGet returns the value at tokens within doc
+func jsonPointerGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, failedPatch(fmt.Sprintf("member %q does not exist", token))
+			}
+			doc = value
+		case []interface{}:
+			index, err := jsonArrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, failedPatch(fmt.Sprintf("cannot reference %q within a JSON value which is not an object or array", token))
+		}
+	}
+
+	return doc, nil
+}
+
+// jsonPointerSet adds or replaces the value at tokens within doc, returning the updated document
+func jsonPointerSet(doc interface{}, tokens []string, op string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+
+	token, last := tokens[0], len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		if last {
+			if _, ok := node[token]; !ok && op == "replace" {
+				return nil, failedPatch(fmt.Sprintf("member %q does not exist", token))
+			}
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, failedPatch(fmt.Sprintf("member %q does not exist", token))
+		}
+		updated, err := jsonPointerSet(child, tokens[1:], op, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = updated
+		return node, nil
+
+	case []interface{}:
+		index, err := jsonArrayIndex(token, len(node), last && op == "add")
+		if err != nil {
+			return nil, err
+		}
+		if !last {
+			updated, err := jsonPointerSet(node[index], tokens[1:], op, value)
+			if err != nil {
+				return nil, err
+			}
+			node[index] = updated
+			return node, nil
+		}
+		if op == "replace" {
+			node[index] = value
+			return node, nil
+		}
+		// insert value before index
+		node = append(node, nil)
+		copy(node[index+1:], node[index:])
+		node[index] = value
+		return node, nil
+	}
+
+	return nil, failedPatch(fmt.Sprintf("cannot reference %q within a JSON value which is not an object or array", token))
+}
+
+// jsonPointerRemove removes the value at tokens within doc, returning the updated document and the removed value
+func jsonPointerRemove(doc interface{}, tokens []string) (interface{}, interface{}, error) {
+	token, last := tokens[0], len(tokens) == 1
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, failedPatch(fmt.Sprintf("member %q does not exist", token))
+		}
+		if last {
+			delete(node, token)
+			return node, child, nil
+		}
+		updated, removed, err := jsonPointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = updated
+		return node, removed, nil
+
+	case []interface{}:
+		index, err := jsonArrayIndex(token, len(node), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := node[index]
+			return append(node[:index], node[index+1:]...), removed, nil
+		}
+		updated, removed, err := jsonPointerRemove(node[index], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		node[index] = updated
+		return node, removed, nil
+	}
+
+	return nil, nil, failedPatch(fmt.Sprintf("cannot reference %q within a JSON value which is not an object or array", token))
+}
+
+// jsonCopy returns a deep copy of a parsed JSON value
+func jsonCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, member := range v {
+			copied[key] = jsonCopy(member)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = jsonCopy(element)
+		}
+		return copied
+	}
+
+	return value
+}
+
+// jsonEqual reports whether two parsed JSON values are equal, comparing numbers by value
+func jsonEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		af, errA := av.Float64()
+		bf, errB := bv.Float64()
+		return errA == nil && errB == nil && af == bf
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for key, member := range av {
+			other, ok := bv[key]
+			if !ok || !jsonEqual(member, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return a == b
+}
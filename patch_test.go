@@ -0,0 +1,180 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var jsonPatchTests = []struct {
+	testName     string
+	doc          string
+	patch        string
+	expected     string
+	expectedCode string
+}{
+	{testName: "add member", doc: `{"a": 1}`, patch: `[{"op": "add", "path": "/b", "value": [1, 2]}]`, expected: `{"a": 1, "b": [1, 2]}`},
+	{testName: "add to array", doc: `{"a": [1, 3]}`, patch: `[{"op": "add", "path": "/a/1", "value": 2}, {"op": "add", "path": "/a/-", "value": 4}]`, expected: `{"a": [1, 2, 3, 4]}`},
+	{testName: "remove", doc: `{"a": {"b": 1, "c": 2}, "d": [1, 2]}`, patch: `[{"op": "remove", "path": "/a/b"}, {"op": "remove", "path": "/d/0"}]`, expected: `{"a": {"c": 2}, "d": [2]}`},
+	{testName: "replace", doc: `{"a": "x"}`, patch: `[{"op": "replace", "path": "/a", "value": null}]`, expected: `{"a": null}`},
+	{testName: "move", doc: `{"a": {"b": 1}, "c": {}}`, patch: `[{"op": "move", "from": "/a/b", "path": "/c/d"}]`, expected: `{"a": {}, "c": {"d": 1}}`},
+	{testName: "copy", doc: `{"a": {"b": [1]}}`, patch: `[{"op": "copy", "from": "/a/b", "path": "/c"}, {"op": "add", "path": "/c/-", "value": 2}]`, expected: `{"a": {"b": [1]}, "c": [1, 2]}`},
+	{testName: "test passes", doc: `{"a": {"b": 1.0}}`, patch: `[{"op": "test", "path": "/a", "value": {"b": 1}}]`, expected: `{"a": {"b": 1.0}}`},
+	{testName: "escaped pointer", doc: `{"a/b": 1, "m~n": 2}`, patch: `[{"op": "remove", "path": "/a~1b"}, {"op": "remove", "path": "/m~0n"}]`, expected: `{}`},
+	{testName: "replace whole document", doc: `{"a": 1}`, patch: `[{"op": "replace", "path": "", "value": [1]}]`, expected: `[1]`},
+	{testName: "test fails", doc: `{"a": 1}`, patch: `[{"op": "test", "path": "/a", "value": 2}]`, expectedCode: CodePatchFailed},
+	{testName: "missing member", doc: `{"a": 1}`, patch: `[{"op": "replace", "path": "/b", "value": 2}]`, expectedCode: CodePatchFailed},
+	{testName: "index out of range", doc: `{"a": [1]}`, patch: `[{"op": "add", "path": "/a/2", "value": 2}]`, expectedCode: CodePatchFailed},
+	{testName: "move into child", doc: `{"a": {"b": 1}}`, patch: `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`, expectedCode: CodePatchFailed},
+	{testName: "unknown operation", doc: `{"a": 1}`, patch: `[{"op": "merge", "path": "/a"}]`, expectedCode: CodeInvalidPatch},
+	{testName: "missing value", doc: `{"a": 1}`, patch: `[{"op": "add", "path": "/a"}]`, expectedCode: CodeInvalidPatch},
+	{testName: "not an array", doc: `{"a": 1}`, patch: `{"op": "add", "path": "/a", "value": 1}`, expectedCode: CodeInvalidPatch},
+}
+
+func TestTools_ApplyJSONPatch(t *testing.T) {
+	var testTool Tools
+
+	for _, test := range jsonPatchTests {
+		patched, err := testTool.ApplyJSONPatch([]byte(test.doc), []byte(test.patch))
+		if test.expectedCode != "" {
+			var jsonError *JSONError
+			if !errors.As(err, &jsonError) || jsonError.Code != test.expectedCode {
+				t.Errorf("%s: expected %s error but received %v", test.testName, test.expectedCode, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			continue
+		}
+
+		if !jsonDocumentsEqual(t, patched, []byte(test.expected)) {
+			t.Errorf("%s: expected %s, received %s", test.testName, test.expected, patched)
+		}
+	}
+}
+
+var mergePatchTests = []struct {
+	testName string
+	doc      string
+	patch    string
+	expected string
+}{
+	{testName: "RFC 7396 example", doc: `{"title": "Goodbye!", "author": {"givenName": "John", "familyName": "Doe"}, "tags": ["example", "sample"], "content": "This will be unchanged"}`, patch: `{"title": "Hello!", "phoneNumber": "+01-123-456-7890", "author": {"familyName": null}, "tags": ["example"]}`, expected: `{"title": "Hello!", "author": {"givenName": "John"}, "tags": ["example"], "content": "This will be unchanged", "phoneNumber": "+01-123-456-7890"}`},
+	{testName: "replace with non-object", doc: `{"a": "b"}`, patch: `["c"]`, expected: `["c"]`},
+	{testName: "patch non-object", doc: `["a"]`, patch: `{"a": {"b": null, "c": 1}}`, expected: `{"a": {"c": 1}}`},
+}
+
+func TestTools_ApplyMergePatch(t *testing.T) {
+	var testTool Tools
+
+	for _, test := range mergePatchTests {
+		patched, err := testTool.ApplyMergePatch([]byte(test.doc), []byte(test.patch))
+		if err != nil {
+			t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			continue
+		}
+
+		if !jsonDocumentsEqual(t, patched, []byte(test.expected)) {
+			t.Errorf("%s: expected %s, received %s", test.testName, test.expected, patched)
+		}
+	}
+}
+
+type patchAccount struct {
+	Name    string   `json:"name" validate:"required"`
+	Balance int64    `json:"balance"`
+	Tags    []string `json:"tags,omitempty"`
+	Secret  string   `json:"-"`
+}
+
+func TestTools_ReadJSONPatch(t *testing.T) {
+	var testTool Tools
+	testTool.ValidateJSON = true
+
+	account := patchAccount{Name: "joe", Balance: 9007199254740993}
+
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "add", "path": "/tags", "value": ["vip"]}, {"op": "replace", "path": "/name", "value": "jo"}]`))
+	err := testTool.ReadJSONPatch(httptest.NewRecorder(), req, &account)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if account.Name != "jo" || len(account.Tags) != 1 || account.Balance != 9007199254740993 {
+		t.Errorf("incorrect patched struct: %+v", account)
+	}
+
+	// patch producing an invalid type leaves target unchanged
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "replace", "path": "/balance", "value": "lots"}]`))
+	err = testTool.ReadJSONPatch(httptest.NewRecorder(), req, &account)
+
+	var jsonError *JSONError
+	if !errors.As(err, &jsonError) || jsonError.Field != "balance" || jsonError.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("expected patch failure for balance but received %v", err)
+	}
+
+	// patch failing validation leaves target unchanged
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "remove", "path": "/name"}]`))
+	err = testTool.ReadJSONPatch(httptest.NewRecorder(), req, &account)
+
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Errorf("expected validation error but received %v", err)
+	}
+
+	if account.Name != "jo" || account.Balance != 9007199254740993 {
+		t.Errorf("target changed by failed patch: %+v", account)
+	}
+
+	// patch operation errors identify the operation
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`[{"op": "add", "path": "/tags/-", "value": "new"}, {"op": "remove", "path": "/nothing"}]`))
+	err = testTool.ReadJSONPatch(httptest.NewRecorder(), req, &account)
+	if !errors.As(err, &jsonError) || jsonError.Field != "[1]" {
+		t.Errorf("expected error for operation [1] but received %v", err)
+	}
+}
+
+func TestTools_ReadMergePatch(t *testing.T) {
+	var testTool Tools
+
+	doc := json.RawMessage(`{"name": "joe", "tags": ["a"]}`)
+
+	req := httptest.NewRequest("PATCH", "/", strings.NewReader(`{"tags": null, "age": 3}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	err := testTool.ReadMergePatch(httptest.NewRecorder(), req, &doc)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if !jsonDocumentsEqual(t, doc, []byte(`{"name": "joe", "age": 3}`)) {
+		t.Errorf("incorrect patched document: %s", doc)
+	}
+
+	// size limit applies to the patch
+	testTool.MaxJSONPayloadSize = 4
+	req = httptest.NewRequest("PATCH", "/", strings.NewReader(`{"tags": null}`))
+	err = testTool.ReadMergePatch(httptest.NewRecorder(), req, &doc)
+
+	var jsonError *JSONError
+	if !errors.As(err, &jsonError) || jsonError.Code != CodeBodyTooLarge {
+		t.Errorf("expected body too large error but received %v", err)
+	}
+}
+
+// jsonDocumentsEqual compares two JSON documents by value
+func jsonDocumentsEqual(t *testing.T, a, b []byte) bool {
+	parsedA, err := parseJSONDocument(a)
+	if err != nil {
+		t.Error("invalid JSON:", err)
+	}
+
+	parsedB, err := parseJSONDocument(b)
+	if err != nil {
+		t.Error("invalid JSON:", err)
+	}
+
+	return jsonEqual(parsedA, parsedB)
+}
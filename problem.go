@@ -0,0 +1,118 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// ProblemDetails is an RFC 7807 problem details document. Any Extensions are written as additional top level members.
+// ProblemDetails is also an error, so handlers may pass one to ErrorJSON or ProblemJSON to control every member
+type ProblemDetails struct {
+	Type       string                 `json:"type"`
+	Title      string                 `json:"title"`
+	Status     int                    `json:"status"`
+	Detail     string                 `json:"detail,omitempty"`
+	Instance   string                 `json:"instance,omitempty"`
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p *ProblemDetails) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// StatusCode returns Status, or 400 Bad Request if it is not set, so that ErrorJSON sends the problem's status code
+// even when UseProblemDetails is not set
+func (p *ProblemDetails) StatusCode() int {
+	if p.Status != 0 {
+		return p.Status
+	}
+
+	return http.StatusBadRequest
+}
+
+// MarshalJSON writes the standard members of the document followed by any extension members
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	members := make(map[string]interface{}, len(p.Extensions)+5)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	// standard members take precedence over extensions of the same name
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+
+	return json.Marshal(members)
+}
+
+// ProblemJSON takes an error and an optional status code, then generates and sends an RFC 7807 problem details document.
+// If err is, or wraps, a *ProblemDetails its members are used, otherwise type is 'about:blank', title the status text
+// and detail the error message (the status text for 5xx errors, see ErrorJSON). Errors which implement FieldErrorer
+// have their field errors, unless masked as for 5xx errors, added as an 'errors' member, and any request ID (see
+// RequestID) a 'request_id' member
+func (t *Tools) ProblemJSON(w http.ResponseWriter, err error, status ...int) error {
+	var problem ProblemDetails
+	var errorProblem *ProblemDetails
+	isProblem := errors.As(err, &errorProblem)
+	if isProblem {
+		problem = *errorProblem
+	}
+
+	// default status code, unless supplied by user, problem or error
+	if len(status) > 0 {
+		problem.Status = status[0]
+	}
+	var statusCoder StatusCoder
+	if problem.Status == 0 && errors.As(err, &statusCoder) {
+		problem.Status = statusCoder.StatusCode()
+	}
+	if problem.Status == 0 {
+		problem.Status = http.StatusBadRequest
+	}
+	if problem.Type == "" {
+		problem.Type = "about:blank"
+	}
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+
+	// log error, masking the detail of 5xx errors unless the caller supplied a problem
+	detail, requestID := t.reportError(w, err, problem.Status)
+	if !isProblem {
+		problem.Detail = detail
+	}
+
+	// list the individual fields at fault, if known, and the request ID without altering the caller's extensions
+	var fieldErrors []FieldError
+	var fieldErrorer FieldErrorer
+	if errors.As(err, &fieldErrorer) && !t.masksError(problem.Status) {
+		fieldErrors = fieldErrorer.FieldErrors()
+	}
+	if len(fieldErrors) > 0 || requestID != "" {
+		extensions := make(map[string]interface{}, len(problem.Extensions)+2)
+		for key, value := range problem.Extensions {
+			extensions[key] = value
+		}
+		if len(fieldErrors) > 0 {
+			extensions["errors"] = fieldErrors
+		}
+		if _, ok := extensions["request_id"]; !ok && requestID != "" {
+			extensions["request_id"] = requestID
+		}
+		problem.Extensions = extensions
+	}
+
+	t.noStore(w)
+
+	return t.writeJSON(w, problem.Status, "application/problem+json", problem)
+}
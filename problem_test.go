@@ -0,0 +1,137 @@
+package toolkit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var problemTests = []struct {
+	testName       string
+	err            error
+	status         []int
+	expectedType   string
+	expectedTitle  string
+	expectedStatus int
+	expectedDetail string
+}{
+	{testName: "plain error", err: errors.New("plain error"), expectedType: "about:blank", expectedTitle: "Bad Request", expectedStatus: 400, expectedDetail: "plain error"},
+	{testName: "plain error with status", err: errors.New("plain error"), status: []int{404}, expectedType: "about:blank", expectedTitle: "Not Found", expectedStatus: 404, expectedDetail: "plain error"},
+	{testName: "problem error", err: &ProblemDetails{Type: "https://example.com/probs/out-of-credit", Title: "You do not have enough credit.", Status: 403, Detail: "Your current balance is 30"}, expectedType: "https://example.com/probs/out-of-credit", expectedTitle: "You do not have enough credit.", expectedStatus: 403, expectedDetail: "Your current balance is 30"},
+	{testName: "wrapped problem error", err: fmt.Errorf("handler: %w", &ProblemDetails{Status: 409}), status: []int{422}, expectedType: "about:blank", expectedTitle: "Unprocessable Entity", expectedStatus: 422, expectedDetail: ""},
+}
+
+func TestTools_ProblemJSON(t *testing.T) {
+	var testTool Tools
+
+	for _, test := range problemTests {
+		rr := httptest.NewRecorder()
+
+		err := testTool.ProblemJSON(rr, test.err, test.status...)
+		if err != nil {
+			t.Errorf("%s: problem JSON(): %v", test.testName, err)
+		}
+
+		if rr.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("%s: incorrect content type: %s", test.testName, rr.Header().Get("Content-Type"))
+		}
+
+		if rr.Code != test.expectedStatus {
+			t.Errorf("%s: incorrect status code: expected %d, received %d", test.testName, test.expectedStatus, rr.Code)
+		}
+
+		var problem ProblemDetails
+		err = json.NewDecoder(rr.Body).Decode(&problem)
+		if err != nil {
+			t.Errorf("%s: received error when decoding JSON: %v", test.testName, err)
+		}
+
+		if problem.Type != test.expectedType || problem.Title != test.expectedTitle || problem.Status != test.expectedStatus || problem.Detail != test.expectedDetail {
+			t.Errorf("%s: incorrect problem returned: %+v", test.testName, problem)
+		}
+	}
+}
+
+func TestTools_ErrorJSONProblemDetails(t *testing.T) {
+	var testTool Tools
+	testTool.UseProblemDetails = true
+
+	rr := httptest.NewRecorder()
+
+	problemError := &ProblemDetails{
+		Instance:   "/orders/42",
+		Extensions: map[string]interface{}{"balance": 30, "type": "ignored"},
+	}
+	err := testTool.ErrorJSON(rr, newProblemValidationError(problemError), http.StatusUnprocessableEntity)
+	if err != nil {
+		t.Errorf("error JSON(): %v", err)
+	}
+
+	var members map[string]interface{}
+	err = json.NewDecoder(rr.Body).Decode(&members)
+	if err != nil {
+		t.Error("received error when decoding JSON:", err)
+	}
+
+	if members["type"] != "about:blank" || members["instance"] != "/orders/42" || members["balance"] != float64(30) {
+		t.Errorf("incorrect problem members returned: %v", members)
+	}
+
+	if _, ok := members["errors"]; !ok {
+		t.Errorf("field errors missing from problem: %v", members)
+	}
+
+	if _, ok := members["error"]; ok {
+		t.Errorf("legacy JSONResponse member present in problem: %v", members)
+	}
+
+	if len(problemError.Extensions) != 2 {
+		t.Error("caller's extensions were modified")
+	}
+}
+
+// problemValidationError wraps a problem together with field errors
+type problemValidationError struct {
+	*ProblemDetails
+	ValidationErrors
+}
+
+func (e problemValidationError) Error() string {
+	return e.ProblemDetails.Error()
+}
+
+func (e problemValidationError) Unwrap() error {
+	return e.ProblemDetails
+}
+
+// newProblemValidationError attaches a single field error to problem
+func newProblemValidationError(problem *ProblemDetails) error {
+	return problemValidationError{ProblemDetails: problem, ValidationErrors: ValidationErrors{{Field: "qty", Code: "min", Message: "qty must be at least 1"}}}
+}
+
+func TestTools_ErrorJSONProblemStatus(t *testing.T) {
+	var testTool Tools
+
+	// without UseProblemDetails the problem still determines the status code
+	rr := httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, fmt.Errorf("loading order: %w", &ProblemDetails{Status: http.StatusNotFound, Detail: "order not found"}))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, received %d", http.StatusNotFound, rr.Code)
+	}
+
+	var payload JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&payload)
+	if !payload.Error || payload.Message != "loading order: order not found" {
+		t.Errorf("incorrect error response: %+v", payload)
+	}
+
+	// problem without a status
+	rr = httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, &ProblemDetails{Title: "Bad"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, received %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,248 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// jitterSource randomises retry delays so that clients which failed together do not retry together
+var (
+	jitterSource = mathrand.New(mathrand.NewSource(time.Now().UnixNano()))
+	jitterMutex  sync.Mutex
+)
+
+// retryableStatuses are the response statuses which indicate a transient failure worth retrying
+var retryableStatuses = map[int]bool{
+	http.StatusRequestTimeout:     true,
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// RetryPolicy determines how calls to remote services are retried after a transient failure, i.e. a network error or
+// a 408, 429, 502, 503 or 504 response. Only idempotent methods are retried, so POST & PATCH requests are sent with a
+// generated Idempotency-Key header (unless one is supplied) which the remote service may use to detect repeats
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts made, including the first (default 1 i.e. no retries)
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubling for every retry thereafter up to MaxDelay; each delay
+	// is randomly reduced by up to half (defaults 100 milliseconds & 10 seconds). A Retry-After header sent by the
+	// remote service is respected, unless longer than MaxDelay in which case the call is not retried
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Budget, if not nil, limits retries across all calls (see RetryBudget)
+	Budget *RetryBudget
+}
+
+// RetryBudget limits retries across all calls sharing it, so that retries cannot overwhelm a remote service which is
+// failing persistently. Following the gRPC retry throttling scheme, every transient failure withdraws a token and
+// every other response deposits Ratio tokens (default 0.1), to a maximum of MaxTokens (default 10); retries are only
+// made while more than half of MaxTokens remain. A RetryBudget must not be copied after first use
+type RetryBudget struct {
+	MaxTokens float64
+	Ratio     float64
+
+	mu          sync.Mutex
+	tokens      float64
+	initialized bool
+}
+
+// record adjusts the budget for the outcome of an attempt, reporting whether a retry may be made
+func (b *RetryBudget) record(failed bool) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// set defaults if not set by user
+	maxTokens, ratio := 10.0, 0.1
+	if b.MaxTokens > 0 {
+		maxTokens = b.MaxTokens
+	}
+	if b.Ratio > 0 {
+		ratio = b.Ratio
+	}
+	if !b.initialized {
+		b.tokens, b.initialized = maxTokens, true
+	}
+
+	if failed {
+		b.tokens--
+		if b.tokens < 0 {
+			b.tokens = 0
+		}
+	} else {
+		b.tokens += ratio
+		if b.tokens > maxTokens {
+			b.tokens = maxTokens
+		}
+	}
+
+	return b.tokens > maxTokens/2
+}
+
+// backoff returns the delay before the given retry (the first being 1), or false if the remote service asked for
+// longer than MaxDelay
+func (p RetryPolicy) backoff(retry int, response *http.Response) (time.Duration, bool) {
+	// set default delays if not set by user
+	baseDelay, maxDelay := 100*time.Millisecond, 10*time.Second
+	if p.BaseDelay > 0 {
+		baseDelay = p.BaseDelay
+	}
+	if p.MaxDelay > 0 {
+		maxDelay = p.MaxDelay
+	}
+
+	delay := maxDelay
+	if shift := retry - 1; shift < 30 && baseDelay<<shift < maxDelay {
+		delay = baseDelay << shift
+	}
+
+	// reduce delay by a random amount of up to half
+	jitterMutex.Lock()
+	delay -= time.Duration(jitterSource.Int63n(int64(delay)/2 + 1))
+	jitterMutex.Unlock()
+
+	if response != nil {
+		if retryAfter, ok := parseRetryAfter(response.Header.Get("Retry-After")); ok {
+			if retryAfter > maxDelay {
+				return 0, false
+			}
+			if retryAfter > delay {
+				delay = retryAfter
+			}
+		}
+	}
+
+	return delay, true
+}
+
+// parseRetryAfter converts a Retry-After header, either a number of seconds or an HTTP date, into a delay
+func parseRetryAfter(retryAfter string) (time.Duration, bool) {
+	if retryAfter == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+
+	return 0, false
+}
+
+// doRemote sends a request to a remote service, making further attempts after transient failures as allowed by
+// RemoteRetry, unless the CircuitBreaker rejects them. It returns the final request made and its response, whose body must be closed by the caller
+func (t *Tools) doRemote(ctx context.Context, client *http.Client, method, uri string, header http.Header, body []byte) (*http.Request, *http.Response, error) {
+	policy := t.RemoteRetry
+
+	// identify POST & PATCH requests so that they can be retried safely
+	header = header.Clone()
+	if policy.MaxAttempts > 1 && (method == http.MethodPost || method == http.MethodPatch) && header.Get("Idempotency-Key") == "" {
+		key, err := newIdempotencyKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		header.Set("Idempotency-Key", key)
+	}
+	idempotent := header.Get("Idempotency-Key") != ""
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		idempotent = true
+	}
+
+	for attempt := 1; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		request, err := http.NewRequestWithContext(ctx, method, uri, reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		request.Header = header.Clone()
+
+		// fail fast if the remote host is failing
+		host := request.URL.Host
+		if err := t.CircuitBreaker.allow(host); err != nil {
+			return request, nil, err
+		}
+
+		response, err := client.Do(request)
+
+		// network errors, other than the call running out of time, and 5xx responses count against the host
+		outcome := circuitSuccess
+		switch {
+		case err != nil && ctx.Err() != nil:
+			outcome = circuitIgnored
+		case err != nil || response.StatusCode >= 500:
+			outcome = circuitFailure
+		}
+		t.CircuitBreaker.record(host, outcome)
+
+		// a transient failure is a network error, other than the call running out of time, or a retryable status
+		failed := (err != nil && ctx.Err() == nil) || (err == nil && retryableStatuses[response.StatusCode])
+		withinBudget := policy.Budget.record(failed)
+		if !failed || !idempotent || attempt >= policy.MaxAttempts || !withinBudget {
+			return request, response, err
+		}
+		if t.CircuitBreaker != nil && t.CircuitBreaker.State(host) == CircuitOpen {
+			return request, response, err
+		}
+		delay, ok := policy.backoff(attempt, response)
+		if !ok {
+			return request, response, err
+		}
+
+		// discard response of failed attempt, allowing its connection to be reused
+		if response != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+			response.Body.Close()
+		}
+		if t.Logger != nil {
+			var reason string
+			if err != nil {
+				reason = err.Error()
+			} else {
+				reason = response.Status
+			}
+			t.Logger.Info("retrying remote service call", "method", method, "url", request.URL.Redacted(),
+				"attempt", attempt, "reason", reason, "delay", delay.String())
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return request, nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newIdempotencyKey returns a random key identifying all attempts at a request
+func newIdempotencyKey() (string, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return "", errors.New("unable to generate idempotency key: " + err.Error())
+	}
+
+	return hex.EncodeToString(key), nil
+}
@@ -0,0 +1,170 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// sequenceClient returns a test client responding with each of statuses in turn, recording every request received
+func sequenceClient(statuses []int, header http.Header, requests *[]*http.Request) *http.Client {
+	return NewTestClient(func(req *http.Request) *http.Response {
+		if req.Body != nil {
+			body, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		*requests = append(*requests, req)
+
+		status := statuses[len(*requests)-1]
+		return &http.Response{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       io.NopCloser(bytes.NewBufferString(`{"message":"` + http.StatusText(status) + `"}`)),
+			Header:     header.Clone(),
+		}
+	})
+}
+
+// endlessBody is a response body which never ends, counting the bytes read from it
+type endlessBody struct {
+	read int64
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = ' '
+	}
+	b.read += int64(len(p))
+	return len(p), nil
+}
+
+func (b *endlessBody) Close() error {
+	return nil
+}
+
+var retryTests = []struct {
+	testName         string
+	method           string
+	statuses         []int
+	header           http.Header
+	maxAttempts      int
+	expectedAttempts int
+	expectedStatus   int
+}{
+	{testName: "no retries", method: "GET", statuses: []int{503}, maxAttempts: 0, expectedAttempts: 1, expectedStatus: 503},
+	{testName: "retried until success", method: "GET", statuses: []int{502, 503, 200}, maxAttempts: 4, expectedAttempts: 3, expectedStatus: 200},
+	{testName: "attempts exhausted", method: "DELETE", statuses: []int{503, 503, 503}, maxAttempts: 3, expectedAttempts: 3, expectedStatus: 503},
+	{testName: "not transient", method: "GET", statuses: []int{500, 200}, maxAttempts: 3, expectedAttempts: 1, expectedStatus: 500},
+	{testName: "post with idempotency key", method: "POST", statuses: []int{429, 201}, maxAttempts: 3, expectedAttempts: 2, expectedStatus: 201},
+	{testName: "retry after too long", method: "GET", statuses: []int{503, 200}, header: http.Header{"Retry-After": {"3600"}}, maxAttempts: 3, expectedAttempts: 1, expectedStatus: 503},
+}
+
+func TestTools_RemoteRetry(t *testing.T) {
+	for _, e := range retryTests {
+		var requests []*http.Request
+		testTool := Tools{
+			HTTPClient:  sequenceClient(e.statuses, e.header, &requests),
+			RemoteRetry: RetryPolicy{MaxAttempts: e.maxAttempts, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+		}
+
+		response, err := testTool.DoJSON(JSONRequest{Method: e.method, URL: "http://example.com/items", Body: map[string]int{"qty": 1}})
+
+		if len(requests) != e.expectedAttempts {
+			t.Errorf("%s: expected %d attempts but made %d", e.testName, e.expectedAttempts, len(requests))
+		}
+		if response == nil || response.StatusCode != e.expectedStatus {
+			t.Errorf("%s: expected final status %d but received %+v (%v)", e.testName, e.expectedStatus, response, err)
+		}
+		if e.expectedStatus >= 300 && !errors.As(err, new(*RemoteError)) {
+			t.Errorf("%s: expected *RemoteError but received %v", e.testName, err)
+		}
+
+		// every attempt carries the full body, and POSTs the same idempotency key
+		for _, req := range requests {
+			if req.Body == nil {
+				t.Fatalf("%s: no body sent", e.testName)
+			}
+			body, _ := io.ReadAll(req.Body)
+			if string(body) != `{"qty":1}` {
+				t.Errorf("%s: incorrect body sent: %s", e.testName, body)
+			}
+			key := req.Header.Get("Idempotency-Key")
+			if (e.method == "POST") != (key != "") || key != requests[0].Header.Get("Idempotency-Key") {
+				t.Errorf("%s: incorrect idempotency key %q", e.testName, key)
+			}
+		}
+	}
+}
+
+func TestTools_RemoteRetryEndlessBody(t *testing.T) {
+	endless := &endlessBody{}
+	attempts := 0
+	testTool := Tools{
+		HTTPClient: NewTestClient(func(req *http.Request) *http.Response {
+			attempts++
+			if attempts == 1 {
+				return &http.Response{StatusCode: http.StatusServiceUnavailable, Body: endless, Header: make(http.Header)}
+			}
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}
+		}),
+		RemoteRetry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+
+	// the body of the failed attempt is discarded without reading it all
+	_, err := testTool.GetJSON("http://example.com", nil)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	if endless.read > 2<<20 {
+		t.Errorf("read %d bytes of the failed attempt's body", endless.read)
+	}
+}
+
+func TestTools_RemoteRetryAfter(t *testing.T) {
+	var requests []*http.Request
+	testTool := Tools{
+		HTTPClient:  sequenceClient([]int{503, 200}, http.Header{"Retry-After": {"1"}}, &requests),
+		RemoteRetry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond},
+	}
+
+	start := time.Now()
+	_, err := testTool.GetJSON("http://example.com", nil)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retry-After not respected, retried after %s", elapsed)
+	}
+}
+
+func TestTools_RetryBudget(t *testing.T) {
+	budget := &RetryBudget{MaxTokens: 4, Ratio: 1}
+
+	var requests []*http.Request
+	statuses := []int{503, 503, 503, 503, 503, 503}
+	testTool := Tools{
+		HTTPClient:  sequenceClient(statuses, nil, &requests),
+		RemoteRetry: RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, Budget: budget},
+	}
+
+	// tokens fall 4 > 3 > 2, stopping retries once no more than half remain
+	_, _ = testTool.GetJSON("http://example.com", nil)
+	if len(requests) != 2 {
+		t.Errorf("expected retries to stop when budget exhausted but made %d attempts", len(requests))
+	}
+
+	// budget is shared, so further calls are not retried until successes replenish it
+	_, _ = testTool.GetJSON("http://example.com", nil)
+	if len(requests) != 3 {
+		t.Errorf("expected no retries while budget exhausted but made %d attempts", len(requests)-2)
+	}
+
+	budget.record(false)
+	budget.record(false)
+	if !budget.record(false) {
+		t.Error("expected budget to be replenished by successful calls")
+	}
+}
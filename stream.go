@@ -0,0 +1,236 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// JSONStreamFormat determines how StreamJSON lays out the items it writes
+type JSONStreamFormat int
+
+const (
+	// JSONArray writes items as the elements of a single JSON array
+	JSONArray JSONStreamFormat = iota
+	// NDJSON writes items as newline delimited JSON values (JSON Lines)
+	NDJSON
+)
+
+// JSONStreamIterator returns the next item to be streamed; ok is false once there are no more items
+type JSONStreamIterator func() (item interface{}, ok bool, err error)
+
+// WriteJSONStream takes a response status code & any data then encodes JSON directly to the client, without first
+// marshalling the entire payload into memory. As the status code is sent before encoding starts, an encoding error
+// can only be returned to the caller and NOT reported to the client
+func (t *Tools) WriteJSONStream(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
+	t.applyHeaders(w, headers...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	return json.NewEncoder(w).Encode(data)
+}
+
+// StreamJSON writes every item received from the items channel to the client, either as a JSON array or as NDJSON,
+// flushing the response every JSONStreamFlushCount items. Streaming ends when the channel is closed. Should writing
+// fail, e.g. because the client has gone, the error is returned and the rest of the channel drained in the background
+// so that the producer is never left blocked; producers should still stop, and close the channel, once the request's
+// context is done rather than producing items which will be discarded
+func (t *Tools) StreamJSON(w http.ResponseWriter, status int, format JSONStreamFormat, items <-chan interface{}, headers ...http.Header) error {
+	err := t.StreamJSONFunc(w, status, format, func() (interface{}, bool, error) {
+		item, ok := <-items
+		return item, ok, nil
+	}, headers...)
+	if err != nil {
+		go func() {
+			for range items {
+			}
+		}()
+	}
+
+	return err
+}
+
+// StreamJSONFunc writes every item returned by next to the client, either as a JSON array or as NDJSON, flushing the
+// response every JSONStreamFlushCount items. Streaming ends when next reports no more items or returns an error
+func (t *Tools) StreamJSONFunc(w http.ResponseWriter, status int, format JSONStreamFormat, next JSONStreamIterator, headers ...http.Header) error {
+	if format != JSONArray && format != NDJSON {
+		return errors.New("unknown JSON stream format")
+	}
+
+	// set default number of items between flushes if not set by user
+	flushCount := 100
+	if t.JSONStreamFlushCount > 0 {
+		flushCount = t.JSONStreamFlushCount
+	}
+
+	t.applyHeaders(w, headers...)
+
+	contentType := "application/json"
+	if format == NDJSON {
+		contentType = "application/x-ndjson"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+
+	flusher, canFlush := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	if format == JSONArray {
+		if _, err := w.Write([]byte("[")); err != nil {
+			return err
+		}
+	}
+
+	for n := 0; ; n++ {
+		item, ok, err := next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		// array elements are separated by commas, encoder already terminates each NDJSON value with a newline
+		if format == JSONArray && n > 0 {
+			if _, err := w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+
+		if canFlush && (n+1)%flushCount == 0 {
+			flusher.Flush()
+		}
+	}
+
+	if format == JSONArray {
+		if _, err := w.Write([]byte("]")); err != nil {
+			return err
+		}
+	}
+
+	if canFlush {
+		flusher.Flush()
+	}
+
+	return nil
+}
+
+// JSONStreamError is returned by ReadJSONStream and identifies the item, and the line it begins on, which caused an error
+type JSONStreamError struct {
+	Item int
+	Line int
+	Err  error
+}
+
+func (e *JSONStreamError) Error() string {
+	return fmt.Sprintf("item %d on line %d: %s", e.Item, e.Line, e.Err.Error())
+}
+
+func (e *JSONStreamError) Unwrap() error {
+	return e.Err
+}
+
+// ReadJSONStream reads a request body of NDJSON or concatenated JSON values, decoding each value in turn into a new
+// variable provided by newItem and passing it to fn. The MaxJSONPayloadSize limit applies to the entire body while
+// AllowUnknownFields, ValidateJSON and the strict decoding settings apply to every item. Reading stops at the first
+// error, which is returned as a *JSONStreamError
+func (t *Tools) ReadJSONStream(w http.ResponseWriter, r *http.Request, newItem func() interface{}, fn func(item interface{}) error) error {
+	maxBytes := t.jsonPayloadLimit()
+	// check content type & read request body, keeping track of line numbers
+	requestBody, err := t.jsonRequestBody(w, r, "application/x-ndjson", "application/jsonl", "application/json-seq")
+	if err != nil {
+		return err
+	}
+	lines := &lineCounter{r: requestBody}
+	decoded := json.NewDecoder(lines)
+
+	for n := 1; ; n++ {
+		// split body into individual JSON values
+		var raw json.RawMessage
+		err := decoded.Decode(&raw)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// locate error at the offending character, or wherever reading the body stopped
+			offset := lines.offset - 1
+			var syntaxError *json.SyntaxError
+			if errors.As(err, &syntaxError) {
+				offset = syntaxError.Offset - 1
+			}
+			return &JSONStreamError{Item: n, Line: lines.lineAt(offset), Err: jsonDecodeError(err, maxBytes)}
+		}
+		line := lines.lineAt(decoded.InputOffset() - int64(len(raw)))
+
+		if t.MaxJSONStreamItems > 0 && n > t.MaxJSONStreamItems {
+			return &JSONStreamError{Item: n, Line: line, Err: fmt.Errorf("request body exceeds maximum of %d JSON items", t.MaxJSONStreamItems)}
+		}
+
+		if err := t.checkJSONKind(raw[:1]); err != nil {
+			return &JSONStreamError{Item: n, Line: line, Err: err}
+		}
+
+		// decode item, check it does not contain unknown fields
+		item := newItem()
+		itemDecoder := json.NewDecoder(bytes.NewReader(raw))
+		if !t.AllowUnknownFields {
+			itemDecoder.DisallowUnknownFields()
+		}
+		if t.UseJSONNumber {
+			itemDecoder.UseNumber()
+		}
+		if err := itemDecoder.Decode(item); err != nil {
+			return &JSONStreamError{Item: n, Line: line, Err: jsonDecodeError(err, maxBytes)}
+		}
+		if err := t.checkStrictJSON(raw, item); err != nil {
+			return &JSONStreamError{Item: n, Line: line, Err: err}
+		}
+
+		if t.ValidateJSON {
+			if err := t.Validate(item); err != nil {
+				return &JSONStreamError{Item: n, Line: line, Err: err}
+			}
+		}
+
+		if err := fn(item); err != nil {
+			return &JSONStreamError{Item: n, Line: line, Err: err}
+		}
+	}
+}
+
+// lineCounter records the offsets of newlines read from r so that byte offsets can be converted into line numbers
+type lineCounter struct {
+	r        io.Reader
+	offset   int64
+	newlines []int64
+	line     int
+}
+
+func (lc *lineCounter) Read(p []byte) (int, error) {
+	n, err := lc.r.Read(p)
+	for i, b := range p[:n] {
+		if b == '\n' {
+			lc.newlines = append(lc.newlines, lc.offset+int64(i))
+		}
+	}
+	lc.offset += int64(n)
+
+	return n, err
+}
+
+// lineAt returns the line number of the byte at offset; offsets must be requested in ascending order
+func (lc *lineCounter) lineAt(offset int64) int {
+	for len(lc.newlines) > 0 && lc.newlines[0] < offset {
+		lc.line++
+		lc.newlines = lc.newlines[1:]
+	}
+
+	return lc.line + 1
+}
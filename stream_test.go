@@ -0,0 +1,239 @@
+package toolkit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTools_WriteJSONStream(t *testing.T) {
+	var testTool Tools
+
+	// create recorder
+	rr := httptest.NewRecorder()
+
+	payload := JSONResponse{
+		Error:   false,
+		Message: "from WriteJSONStream()",
+	}
+
+	headers := make(http.Header)
+	headers.Add("ICE", "CREAM")
+
+	err := testTool.WriteJSONStream(rr, http.StatusOK, payload, headers)
+	if err != nil {
+		t.Errorf("failed to write JSON stream: %v", err)
+	}
+
+	var decoded JSONResponse
+	err = json.NewDecoder(rr.Body).Decode(&decoded)
+	if err != nil {
+		t.Error("received error when decoding JSON:", err)
+	}
+
+	if decoded.Message != payload.Message {
+		t.Errorf("incorrect message returned: expected %q, received %q", payload.Message, decoded.Message)
+	}
+
+	if rr.Header().Get("ICE") != "CREAM" {
+		t.Error("user supplied header was not set")
+	}
+}
+
+var streamTests = []struct {
+	testName    string
+	format      JSONStreamFormat
+	items       []int
+	flushCount  int
+	contentType string
+}{
+	{testName: "JSON array", format: JSONArray, items: []int{1, 2, 3}, flushCount: 0, contentType: "application/json"},
+	{testName: "empty JSON array", format: JSONArray, items: []int{}, flushCount: 0, contentType: "application/json"},
+	{testName: "NDJSON", format: NDJSON, items: []int{1, 2, 3}, flushCount: 2, contentType: "application/x-ndjson"},
+}
+
+func TestTools_StreamJSON(t *testing.T) {
+	for _, test := range streamTests {
+		var testTool Tools
+		testTool.JSONStreamFlushCount = test.flushCount
+
+		items := make(chan interface{})
+		go func(values []int) {
+			defer close(items)
+			for _, v := range values {
+				items <- map[string]int{"id": v}
+			}
+		}(test.items)
+
+		rr := httptest.NewRecorder()
+
+		err := testTool.StreamJSON(rr, http.StatusOK, test.format, items)
+		if err != nil {
+			t.Errorf("%s: failed to stream JSON: %v", test.testName, err)
+		}
+
+		if rr.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: incorrect content type: %s", test.testName, rr.Header().Get("Content-Type"))
+		}
+
+		if !rr.Flushed {
+			t.Errorf("%s: response was not flushed", test.testName)
+		}
+
+		var decoded []map[string]int
+		if test.format == JSONArray {
+			err = json.Unmarshal(rr.Body.Bytes(), &decoded)
+			if err != nil {
+				t.Errorf("%s: streamed body is not a valid JSON array: %v", test.testName, err)
+			}
+		} else {
+			scanner := bufio.NewScanner(rr.Body)
+			for scanner.Scan() {
+				var item map[string]int
+				err = json.Unmarshal(scanner.Bytes(), &item)
+				if err != nil {
+					t.Errorf("%s: streamed line is not valid JSON: %v", test.testName, err)
+				}
+				decoded = append(decoded, item)
+			}
+		}
+
+		if len(decoded) != len(test.items) {
+			t.Errorf("%s: expected %d items, received %d", test.testName, len(test.items), len(decoded))
+		}
+	}
+}
+
+// failingWriter is an http.ResponseWriter whose writes fail, as when the client has disconnected
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+func TestTools_StreamJSONWriteError(t *testing.T) {
+	var testTool Tools
+
+	items := make(chan interface{})
+	produced := make(chan struct{})
+	go func() {
+		defer close(produced)
+		defer close(items)
+		for i := 0; i < 10; i++ {
+			items <- map[string]int{"id": i}
+		}
+	}()
+
+	err := testTool.StreamJSON(failingWriter{httptest.NewRecorder()}, http.StatusOK, NDJSON, items)
+	if err == nil {
+		t.Error("error expected but NOT generated")
+	}
+
+	// producer is not left blocked sending items
+	select {
+	case <-produced:
+	case <-time.After(5 * time.Second):
+		t.Error("producer blocked after write error")
+	}
+}
+
+func TestTools_StreamJSONFunc(t *testing.T) {
+	var testTool Tools
+
+	rr := httptest.NewRecorder()
+
+	// iterator which fails after producing one item
+	n := 0
+	err := testTool.StreamJSONFunc(rr, http.StatusOK, JSONArray, func() (interface{}, bool, error) {
+		n++
+		if n > 1 {
+			return nil, false, errors.New("iterator failure")
+		}
+		return n, true, nil
+	})
+	if err == nil {
+		t.Error("expected iterator error but none received")
+	}
+
+	if !strings.HasPrefix(rr.Body.String(), "[1") {
+		t.Errorf("incorrect body streamed before error: %s", rr.Body.String())
+	}
+
+	// unknown format
+	err = testTool.StreamJSONFunc(httptest.NewRecorder(), http.StatusOK, JSONStreamFormat(99), func() (interface{}, bool, error) {
+		return nil, false, nil
+	})
+	if err == nil {
+		t.Error("expected error for unknown stream format but none received")
+	}
+}
+
+var jsonStreamTests = []struct {
+	testName           string
+	json               string
+	maxSize            int
+	maxItems           int
+	allowUnknownFields bool
+	expectedItems      int
+	errorItem          int
+	errorLine          int
+}{
+	{testName: "NDJSON", json: "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n{\"foo\": \"c\"}\n", maxSize: 1024, expectedItems: 3},
+	{testName: "concatenated JSON", json: `{"foo": "a"}{"foo": "b"}`, maxSize: 1024, expectedItems: 2},
+	{testName: "empty request body", json: ``, maxSize: 1024, expectedItems: 0},
+	{testName: "multi-line values", json: "{\n\"foo\": \"a\"\n}\n\n{\n\"foo\": \"b\"\n}", maxSize: 1024, expectedItems: 2},
+	{testName: "badly formed item", json: "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n{\"foo\":}\n", maxSize: 1024, expectedItems: 2, errorItem: 3, errorLine: 3},
+	{testName: "incorrect JSON type", json: "{\"foo\": \"a\"}\n\n{\"foo\": 99}\n", maxSize: 1024, expectedItems: 1, errorItem: 2, errorLine: 3},
+	{testName: "unknown field", json: "{\"foo\": \"a\"}\n{\"foot\": \"b\"}\n", maxSize: 1024, expectedItems: 1, errorItem: 2, errorLine: 2},
+	{testName: "allow unknown field", json: "{\"foo\": \"a\"}\n{\"foot\": \"b\"}\n", maxSize: 1024, allowUnknownFields: true, expectedItems: 2},
+	{testName: "too many items", json: "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n{\"foo\": \"c\"}\n", maxSize: 1024, maxItems: 2, expectedItems: 2, errorItem: 3, errorLine: 3},
+	{testName: "body too large", json: "{\"foo\": \"a\"}\n{\"foo\": \"b\"}\n", maxSize: 16, expectedItems: 1, errorItem: 2, errorLine: 2},
+}
+
+func TestTools_ReadJSONStream(t *testing.T) {
+	for _, test := range jsonStreamTests {
+		var testTool Tools
+		testTool.MaxJSONPayloadSize = test.maxSize
+		testTool.MaxJSONStreamItems = test.maxItems
+		testTool.AllowUnknownFields = test.allowUnknownFields
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(test.json))
+		rr := httptest.NewRecorder()
+
+		var received []string
+		err := testTool.ReadJSONStream(rr, req, func() interface{} {
+			return &struct {
+				Foo string `json:"foo"`
+			}{}
+		}, func(item interface{}) error {
+			received = append(received, item.(*struct {
+				Foo string `json:"foo"`
+			}).Foo)
+			return nil
+		})
+
+		if test.errorItem == 0 && err != nil {
+			t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+		}
+
+		if test.errorItem != 0 {
+			var streamError *JSONStreamError
+			if !errors.As(err, &streamError) {
+				t.Errorf("%s: JSONStreamError expected but received %v", test.testName, err)
+			} else if streamError.Item != test.errorItem || streamError.Line != test.errorLine {
+				t.Errorf("%s: expected error at item %d line %d, received item %d line %d", test.testName, test.errorItem, test.errorLine, streamError.Item, streamError.Line)
+			}
+		}
+
+		if len(received) != test.expectedItems {
+			t.Errorf("%s: expected %d items, received %d", test.testName, test.expectedItems, len(received))
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package toolkittest
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http/httptest"
+	"testing"
+
+	toolkit "github.com/StratoNET/GO-Toolkit"
+)
+
+// AssertJSON checks that rr holds a JSON response, as written by WriteJSON, with the given status, decoding the body
+// into target (which may be nil) for further checks
+func AssertJSON(t testing.TB, rr *httptest.ResponseRecorder, status int, target interface{}) {
+	t.Helper()
+
+	if rr.Code != status {
+		t.Errorf("expected status %d but received %d: %s", status, rr.Code, rr.Body.String())
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if mediaType != "application/json" && mediaType != "application/problem+json" {
+		t.Errorf("expected JSON content type but received %q", rr.Header().Get("Content-Type"))
+	}
+
+	if target != nil {
+		if err := json.Unmarshal(rr.Body.Bytes(), target); err != nil {
+			t.Fatalf("response is not valid JSON: %s: %s", err.Error(), rr.Body.String())
+		}
+	}
+}
+
+// AssertErrorJSON checks that rr holds an error response, as written by ErrorJSON (either as a JSONResponse or as
+// problem details), with the given status and message; an empty message is not checked. Any fields given must be
+// listed among the response's field errors. The decoded JSONResponse is returned, with the problem detail as Message
+func AssertErrorJSON(t testing.TB, rr *httptest.ResponseRecorder, status int, message string, fields ...string) toolkit.JSONResponse {
+	t.Helper()
+
+	var payload struct {
+		toolkit.JSONResponse
+		Detail string `json:"detail"`
+	}
+	AssertJSON(t, rr, status, &payload)
+
+	response := payload.JSONResponse
+	mediaType, _, _ := mime.ParseMediaType(rr.Header().Get("Content-Type"))
+	if mediaType == "application/problem+json" {
+		response.Error, response.Message = true, payload.Detail
+	}
+
+	if !response.Error {
+		t.Error("expected error response but error is false")
+	}
+	if message != "" && response.Message != message {
+		t.Errorf("expected error message %q but received %q", message, response.Message)
+	}
+
+	for _, field := range fields {
+		found := false
+		for _, fieldError := range response.Errors {
+			if fieldError.Field == field {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("expected field error for %q but received %+v", field, response.Errors)
+		}
+	}
+
+	return response
+}
@@ -0,0 +1,186 @@
+package toolkittest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	toolkit "github.com/StratoNET/GO-Toolkit"
+)
+
+// fakeTB records failures instead of failing the test, so assertions can be tested
+type fakeTB struct {
+	testing.TB
+	failures []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Error(args ...interface{}) {
+	f.failures = append(f.failures, fmt.Sprint(args...))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"method":%q,"received":%q}`, r.Method, string(body))
+	}))
+	defer server.Close()
+
+	fixture := filepath.Join(t.TempDir(), "fixtures", "items.json")
+
+	// record real interactions
+	recorder := NewRecorder(fixture, nil)
+	recordingTool := toolkit.Tools{HTTPClient: &http.Client{Transport: recorder}}
+
+	var result map[string]string
+	_, err := recordingTool.PostJSON(server.URL+"/items", map[string]int{"qty": 1}, &result, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil || result["received"] != `{"qty":1}` {
+		t.Fatalf("recorded call failed: %v %v", result, err)
+	}
+	_, _ = recordingTool.GetJSON(server.URL+"/items/1", &result)
+
+	if err := recorder.Save(); err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	if interactions := recorder.Interactions(); len(interactions) != 2 || interactions[0].Request.Header.Get("Authorization") != "REDACTED" {
+		t.Errorf("incorrect interactions recorded: %+v", interactions)
+	}
+
+	// replay them with the server gone
+	server.Close()
+	replayer, err := NewReplayer(fixture)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	replayer.MatchBody = true
+	replayingTool := toolkit.Tools{HTTPClient: &http.Client{Transport: replayer}}
+
+	result = nil
+	_, err = replayingTool.GetJSON(server.URL+"/items/1", &result)
+	if err != nil || result["method"] != "GET" {
+		t.Errorf("incorrect replayed response: %v %v", result, err)
+	}
+	if len(replayer.Unused()) != 1 {
+		t.Errorf("expected 1 unused interaction but received %d", len(replayer.Unused()))
+	}
+
+	// body must match
+	_, err = replayingTool.PostJSON(server.URL+"/items", map[string]int{"qty": 2}, &result)
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+		t.Errorf("expected unmatched body to fail but received %v", err)
+	}
+	_, err = replayingTool.PostJSON(server.URL+"/items", map[string]int{"qty": 1}, &result)
+	if err != nil || result["received"] != `{"qty":1}` || len(replayer.Unused()) != 0 {
+		t.Errorf("incorrect replayed response: %v %v", result, err)
+	}
+
+	// interactions are only replayed once
+	if _, err = replayingTool.GetJSON(server.URL+"/items/1", nil); err == nil {
+		t.Error("expected used interaction not to be replayed")
+	}
+}
+
+func TestRecordAndReplayBinaryBodies(t *testing.T) {
+	binary := []byte{0x1f, 0x8b, 0xff, 0x00, 0xfe}
+	var received []byte
+	next := toolkit.TransportFunc(func(req *http.Request) (*http.Response, error) {
+		received, _ = io.ReadAll(req.Body)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewReader(binary)), Header: make(http.Header)}, nil
+	})
+
+	fixture := filepath.Join(t.TempDir(), "binary.json")
+
+	// record a gzip compressed request answered by a binary response
+	recorder := NewRecorder(fixture, next)
+	recordingTool := toolkit.Tools{HTTPClient: &http.Client{Transport: recorder}, GzipRemoteRequests: true}
+	_, err := recordingTool.PostJSON("http://example.com/items", map[string]int{"qty": 1}, nil)
+	if err != nil || utf8.Valid(received) {
+		t.Fatalf("recorded call failed or was not compressed: %v", err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	if interaction := recorder.Interactions()[0]; interaction.Request.BodyEncoding != "base64" || interaction.Response.BodyEncoding != "base64" {
+		t.Errorf("expected base64 encoded bodies but received %+v", interaction)
+	}
+
+	// replay, matching the compressed body
+	replayer, err := NewReplayer(fixture)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	replayer.MatchBody = true
+	replayingTool := toolkit.Tools{HTTPClient: &http.Client{Transport: replayer}, GzipRemoteRequests: true}
+
+	response, err := replayingTool.PostJSON("http://example.com/items", map[string]int{"qty": 1}, nil)
+	if err != nil || !bytes.Equal(response.Body, binary) {
+		t.Errorf("incorrect replayed response: %v %v", response, err)
+	}
+}
+
+func TestAssertJSON(t *testing.T) {
+	var tools toolkit.Tools
+
+	rr := httptest.NewRecorder()
+	_ = tools.WriteJSON(rr, http.StatusCreated, toolkit.JSONResponse{Message: "created"})
+
+	var response toolkit.JSONResponse
+	AssertJSON(t, rr, http.StatusCreated, &response)
+	if response.Message != "created" {
+		t.Errorf("incorrect decoded response: %+v", response)
+	}
+
+	fake := &fakeTB{}
+	AssertJSON(fake, rr, http.StatusOK, nil)
+	if len(fake.failures) != 1 {
+		t.Errorf("expected status failure but received %v", fake.failures)
+	}
+}
+
+func TestAssertErrorJSON(t *testing.T) {
+	for _, problemDetails := range []bool{false, true} {
+		tools := toolkit.Tools{UseProblemDetails: problemDetails}
+		err := toolkit.ValidationErrors{{Field: "name", Code: "required", Message: "name is required"}}
+
+		rr := httptest.NewRecorder()
+		_ = tools.ErrorJSON(rr, err)
+
+		response := AssertErrorJSON(t, rr, http.StatusBadRequest, err.Error(), "name")
+		if len(response.Errors) != 1 {
+			t.Errorf("problem details %t: incorrect decoded response: %+v", problemDetails, response)
+		}
+
+		fake := &fakeTB{}
+		AssertErrorJSON(fake, rr, http.StatusBadRequest, "other message", "email")
+		if len(fake.failures) != 2 {
+			t.Errorf("problem details %t: expected message & field failures but received %v", problemDetails, fake.failures)
+		}
+	}
+
+	// successful response is not an error
+	var tools toolkit.Tools
+	rr := httptest.NewRecorder()
+	_ = tools.WriteJSON(rr, http.StatusBadRequest, toolkit.JSONResponse{})
+	fake := &fakeTB{}
+	AssertErrorJSON(fake, rr, http.StatusBadRequest, "")
+	if len(fake.failures) != 1 {
+		t.Errorf("expected error flag failure but received %v", fake.failures)
+	}
+
+}
@@ -0,0 +1,270 @@
+// Package toolkittest provides helpers for testing code which uses the toolkit: transports which record calls to
+// remote services as fixture files and replay them, and assertions for responses written by WriteJSON & ErrorJSON
+package toolkittest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"unicode/utf8"
+)
+
+// Interaction is a request to a remote service and the response received, as held in a fixture file
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is the part of a request saved in a fixture file. Body is held as text, or if it is not valid UTF-8
+// (e.g. a gzip compressed body) base64 encoded with BodyEncoding set to "base64"
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// RecordedResponse is the part of a response saved in a fixture file, its Body held just as that of a RecordedRequest
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// encodeBody returns body as saved in a fixture file, and the encoding used
+func encodeBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+// decodeBody returns the body saved in a fixture file with the given encoding
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	}
+
+	return nil, fmt.Errorf("unknown body encoding %q", encoding)
+}
+
+// DefaultRedactedHeaders are the headers whose values a Recorder replaces with "REDACTED" unless told otherwise
+var DefaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "Proxy-Authorization"}
+
+// Recorder is an http.RoundTripper which passes requests on to a real transport, recording each interaction so that
+// Save can write them to a fixture file for a Replayer to serve
+type Recorder struct {
+	// Next is the transport requests are passed to (default http.DefaultTransport)
+	Next http.RoundTripper
+	// RedactHeaders are the headers whose values are not saved (default DefaultRedactedHeaders)
+	RedactHeaders []string
+
+	path         string
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+// NewRecorder returns a Recorder which will save its interactions to the fixture file at path
+func NewRecorder(path string, next http.RoundTripper) *Recorder {
+	return &Recorder{Next: next, path: path}
+}
+
+// RoundTrip sends req using the Next transport and records the interaction
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := r.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	// read request body, leaving it intact for the next transport
+	var requestBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		requestBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(requestBody))
+	}
+
+	response, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// read response body, leaving it intact for the caller
+	responseBody, err := io.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	response.Body = io.NopCloser(bytes.NewReader(responseBody))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	recorded := Interaction{
+		Request:  RecordedRequest{Method: req.Method, URL: req.URL.String(), Header: r.redact(req.Header)},
+		Response: RecordedResponse{StatusCode: response.StatusCode, Header: r.redact(response.Header)},
+	}
+	recorded.Request.Body, recorded.Request.BodyEncoding = encodeBody(requestBody)
+	recorded.Response.Body, recorded.Response.BodyEncoding = encodeBody(responseBody)
+	r.interactions = append(r.interactions, recorded)
+
+	return response, nil
+}
+
+// Interactions returns the interactions recorded so far
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save writes the recorded interactions to the fixture file, creating its directory if necessary
+func (r *Recorder) Save() error {
+	data, err := json.MarshalIndent(r.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(r.path), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// redact returns a copy of header with the values of RedactHeaders replaced
+func (r *Recorder) redact(header http.Header) http.Header {
+	redactHeaders := r.RedactHeaders
+	if redactHeaders == nil {
+		redactHeaders = DefaultRedactedHeaders
+	}
+
+	redacted := header.Clone()
+	for _, key := range redactHeaders {
+		if values := redacted.Values(key); len(values) > 0 {
+			redacted[http.CanonicalHeaderKey(key)] = []string{"REDACTED"}
+		}
+	}
+
+	return redacted
+}
+
+// Replayer is an http.RoundTripper which serves the interactions held in a fixture file, without calling any remote
+// service. Each request is answered by the first interaction not yet used with the same method & URL (and, if
+// MatchBody is set, the same body); a request with no such interaction fails
+type Replayer struct {
+	MatchBody bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	// requestBodies & responseBodies hold the decoded body of each interaction
+	requestBodies  [][]byte
+	responseBodies [][]byte
+}
+
+// NewReplayer returns a Replayer serving the interactions in the fixture file at path
+func NewReplayer(path string) (*Replayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var interactions []Interaction
+	err = json.Unmarshal(data, &interactions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid fixture file %s: %w", path, err)
+	}
+
+	replayer := &Replayer{interactions: interactions, used: make([]bool, len(interactions))}
+	for i, interaction := range interactions {
+		requestBody, err := decodeBody(interaction.Request.Body, interaction.Request.BodyEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture file %s: request %d: %w", path, i+1, err)
+		}
+		responseBody, err := decodeBody(interaction.Response.Body, interaction.Response.BodyEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fixture file %s: response %d: %w", path, i+1, err)
+		}
+		replayer.requestBodies = append(replayer.requestBodies, requestBody)
+		replayer.responseBodies = append(replayer.responseBodies, responseBody)
+	}
+
+	return replayer, nil
+}
+
+// RoundTrip answers req with the matching recorded response
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		recorded := interaction.Request
+		if r.used[i] || recorded.Method != req.Method || recorded.URL != req.URL.String() {
+			continue
+		}
+		if r.MatchBody && !bytes.Equal(r.requestBodies[i], body) {
+			continue
+		}
+		r.used[i] = true
+		responseBody := r.responseBodies[i]
+
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode:    interaction.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        interaction.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(responseBody)),
+			ContentLength: int64(len(responseBody)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("toolkittest: no recorded interaction for %s %s", req.Method, req.URL)
+}
+
+// Unused returns the interactions which have not been replayed, so tests can check every expected call was made
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, interaction)
+		}
+	}
+
+	return unused
+}
@@ -1,7 +1,9 @@
 package toolkit
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/json"
 	"errors"
@@ -15,6 +17,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 )
 
 const randomStringSource = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_+-="
@@ -25,6 +28,72 @@ type Tools struct {
 	MaxFileSize        int
 	MaxJSONPayloadSize int
 	AllowUnknownFields bool
+	// ValidateJSON applies the 'validate' tag rules of a struct (see Validate) after ReadJSON has decoded into it
+	ValidateJSON bool
+	// MaxJSONStreamItems is the maximum number of items ReadJSONStream will accept (default unlimited)
+	MaxJSONStreamItems int
+	// RequireJSONContentType makes ReadJSON reject, with 415 Unsupported Media Type, bodies which are not sent as
+	// application/json (or a +json type) in UTF-8
+	RequireJSONContentType bool
+	// UseProblemDetails makes ErrorJSON send RFC 7807 application/problem+json documents instead of a JSONResponse
+	UseProblemDetails bool
+	// DisallowDuplicateKeys makes ReadJSON reject objects containing the same key more than once, rather than the last
+	// value silently taking effect
+	DisallowDuplicateKeys bool
+	// DisallowNullFields makes ReadJSON reject null for fields which cannot hold nil, rather than ignoring it
+	DisallowNullFields bool
+	// UseJSONNumber makes ReadJSON decode numbers within interface{} values as json.Number rather than float64
+	UseJSONNumber bool
+	// RequireJSONKind makes ReadJSON reject bodies whose top level value is not of the given kind e.g. JSONKindObject
+	RequireJSONKind JSONKind
+	// DefaultPageSize & MaxPageSize are the default and maximum per_page values accepted by ReadPagination (20 & 100)
+	DefaultPageSize int
+	MaxPageSize     int
+	// DefaultHeaders are added to every response written by WriteJSON, ErrorJSON & the streaming writers, before any
+	// headers supplied with the call
+	DefaultHeaders http.Header
+	// SecureJSONHeaders makes WriteJSON & ErrorJSON send 'X-Content-Type-Options: nosniff' and a Content-Type with
+	// charset=utf-8, and makes error responses 'Cache-Control: no-store'
+	SecureJSONHeaders bool
+	// DisableJSONHTMLEscaping stops <, > and & being escaped as \u003c, \u003e and \u0026 in JSON responses
+	DisableJSONHTMLEscaping bool
+	// JSONPrefix is written before every JSON response to prevent JSON hijacking, e.g. ")]}',\n", which clients must
+	// strip before decoding
+	JSONPrefix string
+	// CompressDownloads makes DownloadStaticFile compress files with gzip or deflate when the client accepts it, and
+	// CompressionMinSize is the smallest response, in bytes, worth compressing (default 1024; see CompressResponses)
+	CompressDownloads  bool
+	CompressionMinSize int
+	// Logger, if set, receives every error sent by ErrorJSON. Messages of 5xx errors are only logged, the client seeing
+	// just the status text, unless ExposeInternalErrors is set
+	Logger               Logger
+	ExposeInternalErrors bool
+	// RequestIDHeader is the header used by RequestID to propagate request IDs (default X-Request-ID)
+	RequestIDHeader string
+	// HTTPClient is used by DoJSON and the other JSON client methods to call remote services (default
+	// http.DefaultClient)
+	HTTPClient *http.Client
+	// RemoteTimeout limits the time taken by each call to a remote service, including reading the response (default
+	// 30 seconds)
+	RemoteTimeout time.Duration
+	// GzipRemoteRequests compresses the body of every request to a remote service, and MaxRemoteResponseSize limits
+	// the size of the response bodies read (default 10MB)
+	GzipRemoteRequests    bool
+	MaxRemoteResponseSize int64
+	// RemoteRetry determines whether, and how, calls to remote services are retried after transient failures
+	RemoteRetry RetryPolicy
+	// RemoteMiddleware wraps the transport of the client used to call remote services e.g. to authenticate requests
+	// with BearerToken, BasicAuth, APIKey, HMACSignature or OAuth2ClientCredentials
+	RemoteMiddleware []TransportMiddleware
+	// CircuitBreaker, if set, rejects calls to remote hosts which are failing (see CircuitBreaker)
+	CircuitBreaker *CircuitBreaker
+	// WebhookSignatureHeader, WebhookTolerance & WebhookReplayStore configure VerifyWebhook (defaults
+	// X-Webhook-Signature, 5 minutes & a store shared by the whole process)
+	WebhookSignatureHeader string
+	WebhookTolerance       time.Duration
+	WebhookReplayStore     ReplayStore
+	// JSONStreamFlushCount is the number of items written by StreamJSON between flushes (default 100)
+	JSONStreamFlushCount int
 }
 
 // RandomString returns string of random characters of length n, generated from randomStringSource
@@ -226,96 +295,167 @@ func (t *Tools) Slugify(s string) (string, error) {
 }
 
 // DownloadStaticFile downloads a file and forces the browser not to open/display it by setting content disposition;
-// (specification of the file display name is also available)
+// (specification of the file display name is also available). With CompressDownloads set, files are compressed when
+// the client accepts it, unless already of a compressed type
 func (t *Tools) DownloadStaticFile(w http.ResponseWriter, r *http.Request, pathName, fileName, displayName string) {
 	filePath := path.Join(pathName, fileName)
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", displayName))
+
+	// compress file unless of an already compressed type, range requests are served uncompressed
+	if t.CompressDownloads && r.Header.Get("Range") == "" {
+		cw := t.compressWriter(w, r)
+		defer cw.Close()
+		w = cw
+	}
 	http.ServeFile(w, r, filePath)
 }
 
-// JSONResponse is used hold and transport JSON
+// JSONResponse is used hold and transport JSON; Errors lists the individual fields at fault in an error response and
+// Pagination describes the page of results held in Data, while RequestID identifies the request an error relates to
 type JSONResponse struct {
-	Error   bool        `json:"error"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Error      bool         `json:"error"`
+	Message    string       `json:"message"`
+	Data       interface{}  `json:"data,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+	Pagination *PageMeta    `json:"pagination,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
 }
 
-// ReadJSON attempts to read request body and converts from JSON into a data variable
+// ReadJSON attempts to read request body and converts from JSON into a data variable. Bodies compressed with gzip or
+// deflate, according to their Content-Encoding, are decompressed before decoding
 func (t *Tools) ReadJSON(w http.ResponseWriter, r *http.Request, data interface{}) error {
-	// limit possible JSON payload size to 1MB & check
-	maxBytes := 1024 * 1024
-	if t.MaxJSONPayloadSize != 0 {
-		maxBytes = t.MaxJSONPayloadSize
+	maxBytes := t.jsonPayloadLimit()
+	// check content type & read request body, keeping a copy of what is read so that errors can be located
+	requestBody, err := t.jsonRequestBody(w, r)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	buffered := bufio.NewReader(io.TeeReader(requestBody, &body))
+	// check kind of top level value before decoding
+	err = t.checkJSONKind(peekJSONValue(buffered))
+	if err != nil {
+		return err
 	}
-	// read request body
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 	// decode response body
-	decoded := json.NewDecoder(r.Body)
+	decoded := json.NewDecoder(buffered)
 	// check decoded does not contain unknown fields
 	if !t.AllowUnknownFields {
 		decoded.DisallowUnknownFields()
 	}
+	if t.UseJSONNumber {
+		decoded.UseNumber()
+	}
 	// check for a range of potential errors
-	err := decoded.Decode(data)
+	err = decoded.Decode(data)
 	if err != nil {
-		var syntaxError *json.SyntaxError
-		var unmarshalTypeError *json.UnmarshalTypeError
-		var invalidUnmarshalError *json.InvalidUnmarshalError
+		return locateJSONError(jsonDecodeError(err, maxBytes), body.Bytes(), data)
+	}
+	// check that decoded response does not contain more than one JSON file
+	err = checkJSONEnd(decoded, maxBytes)
+	if err != nil {
+		return err
+	}
+	// check body against any strict decoding settings
+	err = t.checkStrictJSON(body.Bytes(), data)
+	if err != nil {
+		return err
+	}
+	// check decoded data against its validation rules
+	if t.ValidateJSON {
+		return t.Validate(data)
+	}
+
+	return nil
+}
 
-		switch {
-		case errors.As(err, &syntaxError):
-			return fmt.Errorf("request body contains badly formed JSON: at character %d", syntaxError.Offset)
+// jsonPayloadLimit returns the maximum permitted size of a JSON request body
+func (t *Tools) jsonPayloadLimit() int {
+	// limit possible JSON payload size to 1MB unless set by user
+	if t.MaxJSONPayloadSize != 0 {
+		return t.MaxJSONPayloadSize
+	}
+	return 1024 * 1024
+}
 
-		case errors.Is(err, io.ErrUnexpectedEOF):
-			return errors.New("request body contains badly formed JSON at some point within")
+// checkJSONEnd reports an error if anything other than whitespace follows the JSON value read by decoded. Errors
+// reading the rest of the body, such as a corrupt compressed body, are reported as such rather than as another value
+func checkJSONEnd(decoded *json.Decoder, maxBytes int) error {
+	var extra json.RawMessage
+	err := decoded.Decode(&extra)
+	if err == io.EOF {
+		return nil
+	}
 
-		case errors.As(err, &unmarshalTypeError):
-			if unmarshalTypeError.Field != "" {
-				return fmt.Errorf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
-			}
-			return fmt.Errorf("request body contains incorrect JSON type: at character %d", unmarshalTypeError.Offset)
+	var syntaxError *json.SyntaxError
+	if err == nil || errors.As(err, &syntaxError) {
+		return &JSONError{Code: CodeMultipleValues, Message: "response body must only contain one JSON value"}
+	}
 
-		case errors.Is(err, io.EOF):
-			return errors.New("request body cannot be empty")
+	return jsonDecodeError(err, maxBytes)
+}
 
-		// this error is only possible if 'AllowUnknownFields' is set to true
-		case strings.HasPrefix(err.Error(), "json: unknown field"):
-			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
-			return fmt.Errorf("request body contains unknown key: %s", fieldName)
+// jsonDecodeError converts an error returned when decoding a JSON request body into a more descriptive *JSONError
+func jsonDecodeError(err error, maxBytes int) error {
+	var syntaxError *json.SyntaxError
+	var unmarshalTypeError *json.UnmarshalTypeError
+	var invalidUnmarshalError *json.InvalidUnmarshalError
 
-		case err.Error() == "http: request body too large":
-			return fmt.Errorf("maximum allowed request body size is %d bytes", maxBytes)
+	var decompressionError *decompressionError
 
-		case errors.As(err, &invalidUnmarshalError):
-			return fmt.Errorf("error unmarshalling JSON request body: %s", err.Error())
+	switch {
+	case errors.As(err, &decompressionError):
+		return &JSONError{Code: CodeInvalidEncoding, Message: "request body could not be decompressed", Err: err}
 
-		default:
-			return err
+	case errors.As(err, &syntaxError):
+		return &JSONError{Code: CodeSyntax, Message: fmt.Sprintf("request body contains badly formed JSON: at character %d", syntaxError.Offset), Err: err}
+
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &JSONError{Code: CodeSyntax, Message: "request body contains badly formed JSON at some point within", Err: err}
+
+	case errors.As(err, &unmarshalTypeError):
+		if unmarshalTypeError.Field != "" {
+			return &JSONError{Field: unmarshalTypeError.Field, Code: CodeType, Message: fmt.Sprintf("request body contains incorrect JSON type for field %q", unmarshalTypeError.Field), Err: err}
 		}
-	}
-	// check that decoded response does not contain more than one JSON file
-	err = decoded.Decode(&struct{}{})
-	if err != io.EOF {
-		return errors.New("response body must only contain one JSON value")
-	}
+		return &JSONError{Code: CodeType, Message: fmt.Sprintf("request body contains incorrect JSON type: at character %d", unmarshalTypeError.Offset), Err: err}
 
-	return nil
+	case errors.Is(err, io.EOF):
+		return &JSONError{Code: CodeEmptyBody, Message: "request body cannot be empty", Err: err}
+
+	// this error is only possible if 'AllowUnknownFields' is set to true
+	case strings.HasPrefix(err.Error(), "json: unknown field"):
+		fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
+		return &JSONError{Field: strings.Trim(fieldName, ` "`), Code: CodeUnknownField, Message: fmt.Sprintf("request body contains unknown key: %s", fieldName), Err: err}
+
+	case err.Error() == "http: request body too large":
+		return &JSONError{Code: CodeBodyTooLarge, Message: fmt.Sprintf("maximum allowed request body size is %d bytes", maxBytes), Err: err}
+
+	case errors.As(err, &invalidUnmarshalError):
+		return &JSONError{Code: CodeInvalidTarget, Message: fmt.Sprintf("error unmarshalling JSON request body: %s", err.Error()), Err: err}
+
+	default:
+		return err
+	}
 }
 
 // WriteJSON takes a response status code & any data then writes JSON to the client
 func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, headers ...http.Header) error {
-	out, err := json.Marshal(data)
+	return t.writeJSON(w, status, "application/json", data, headers...)
+}
+
+// writeJSON writes data as JSON to the client using the given content type
+func (t *Tools) writeJSON(w http.ResponseWriter, status int, contentType string, data interface{}, headers ...http.Header) error {
+	out, err := t.marshalJSON(data)
 	if err != nil {
 		return err
 	}
-	// using only one additional header if required
-	if len(headers) > 0 {
-		for key, value := range headers[0] {
-			w.Header()[key] = value
-		}
-	}
+	t.applyHeaders(w, headers...)
 
-	w.Header().Set("Content-Type", "application/json")
+	if t.SecureJSONHeaders {
+		contentType += "; charset=utf-8"
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
 	_, err = w.Write(out)
 	if err != nil {
@@ -325,10 +465,73 @@ func (t *Tools) WriteJSON(w http.ResponseWriter, status int, data interface{}, h
 	return nil
 }
 
-// ErrorJSON takes an error and an optional status code, then generates and sends a JSON error message
+// marshalJSON encodes data, escaping HTML unless DisableJSONHTMLEscaping is set, and adds any JSONPrefix
+func (t *Tools) marshalJSON(data interface{}) ([]byte, error) {
+	out := bytes.NewBufferString(t.JSONPrefix)
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(!t.DisableJSONHTMLEscaping)
+	err := encoder.Encode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// encoder terminates the value with a newline which json.Marshal would not
+	return bytes.TrimSuffix(out.Bytes(), []byte("\n")), nil
+}
+
+// appendableHeaders may appear more than once in a response, so values supplied for them are added to those present
+var appendableHeaders = map[string]bool{"Link": true, "Set-Cookie": true, "Vary": true, "Via": true, "Warning": true}
+
+// applyHeaders copies DefaultHeaders, then each set of user supplied headers in turn, onto the response. Values for
+// headers which may be repeated (Link, Set-Cookie, Vary, Via & Warning) are added to any already present, while values
+// for any other header replace those present, so that later header sets take precedence over earlier ones. Default
+// headers never replace those already set on the response
+func (t *Tools) applyHeaders(w http.ResponseWriter, headers ...http.Header) {
+	for i, header := range append([]http.Header{t.DefaultHeaders}, headers...) {
+		for key, values := range header {
+			key = http.CanonicalHeaderKey(key)
+			if !appendableHeaders[key] {
+				if _, exists := w.Header()[key]; i > 0 || !exists {
+					w.Header()[key] = append([]string(nil), values...)
+				}
+				continue
+			}
+			for _, value := range values {
+				if !containsString(w.Header()[key], value) {
+					w.Header().Add(key, value)
+				}
+			}
+		}
+	}
+}
+
+// containsString reports whether s is one of values
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ErrorJSON takes an error and an optional status code, then generates and sends a JSON error message; errors which
+// implement FieldErrorer also have their individual field errors listed and, if no status code is supplied, errors
+// which implement StatusCoder determine the status code. If UseProblemDetails is set, an RFC 7807
+// document is sent instead (see ProblemJSON). Errors are passed to Logger, and the messages & field errors of 5xx
+// errors are masked
 func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error {
-	// default status code
+	if t.UseProblemDetails {
+		return t.ProblemJSON(w, err, status...)
+	}
+
+	// default status code, or that of the error
 	statusCode := http.StatusBadRequest
+	var statusCoder StatusCoder
+	if errors.As(err, &statusCoder) {
+		statusCode = statusCoder.StatusCode()
+	}
 	// user supplied status code
 	if len(status) > 0 {
 		statusCode = status[0]
@@ -336,13 +539,40 @@ func (t *Tools) ErrorJSON(w http.ResponseWriter, err error, status ...int) error
 
 	var payload JSONResponse
 	payload.Error = true
-	payload.Message = err.Error()
+	payload.Message, payload.RequestID = t.reportError(w, err, statusCode)
+
+	// list the individual fields at fault, if known, e.g. from ReadJSON or Validate, unless they are masked
+	var fieldErrorer FieldErrorer
+	if errors.As(err, &fieldErrorer) && !t.masksError(statusCode) {
+		payload.Errors = fieldErrorer.FieldErrors()
+	}
+
+	t.noStore(w)
 
 	return t.WriteJSON(w, statusCode, payload)
 }
 
-// PushJSONToRemoteService posts JSON data to remote service, returning a response, status code and any error
+// noStore prevents error responses being cached when SecureJSONHeaders is set
+func (t *Tools) noStore(w http.ResponseWriter) {
+	if t.SecureJSONHeaders {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+}
+
+// PushJSONToRemoteService posts JSON data to remote service, returning a response, status code and any error. The
+// response body has been read in full but may still be read by the caller.
+//
+// Deprecated: use PostJSON, or DoJSON
 func (t *Tools) PushJSONToRemoteService(uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
+	return t.PushJSONToRemoteServiceContext(context.Background(), uri, data, client...)
+}
+
+// PushJSONToRemoteServiceContext works just as PushJSONToRemoteService, the call being abandoned if ctx is done or
+// RemoteTimeout (default 30 seconds) passes, and retried as allowed by RemoteRetry
+func (t *Tools) PushJSONToRemoteServiceContext(ctx context.Context, uri string, data interface{}, client ...*http.Client) (*http.Response, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.remoteTimeout(0))
+	defer cancel()
+
 	// create JSON data
 	jsonData, err := json.Marshal(data)
 	if err != nil {
@@ -356,20 +586,30 @@ func (t *Tools) PushJSONToRemoteService(uri string, data interface{}, client ...
 	if len(client) > 0 {
 		httpClient = client[0]
 	}
+	httpClient = t.wrapClient(httpClient)
 
-	// build request, set header
-	request, err := http.NewRequest("POST", uri, bytes.NewBuffer(jsonData))
+	// set header, compressing JSON data if required, call remote uri retrying if necessary
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	if t.GzipRemoteRequests {
+		jsonData, err = gzipRequestBody(jsonData)
+		if err != nil {
+			return nil, 0, err
+		}
+		header.Set("Content-Encoding", "gzip")
+	}
+	_, response, err := t.doRemote(ctx, httpClient, "POST", uri, header, jsonData)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, remoteCallError(ctx, err)
 	}
-	request.Header.Set("Content-Type", "application/json")
+	defer response.Body.Close()
 
-	// call remote uri
-	response, err := httpClient.Do(request)
+	// read body so that it remains available to the caller once closed
+	body, err := readLimited(response.Body, t.remoteResponseLimit())
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, remoteCallError(ctx, err)
 	}
-	defer response.Body.Close()
+	response.Body = io.NopCloser(bytes.NewReader(body))
 
 	// return response
 	return response, response.StatusCode, nil
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -50,10 +51,16 @@ func TestTools_PushJSONToRemoteService(t *testing.T) {
 	}
 	retro.Rocker = "ok"
 
-	_, _, err := testTool.PushJSONToRemoteService("http://stratosoft.uk/some/path", retro, client)
+	response, _, err := testTool.PushJSONToRemoteService("http://stratosoft.uk/some/path", retro, client)
 	if err != nil {
 		t.Error("failed to call remote service:", err)
 	}
+
+	// check response body remains readable
+	body, _ := io.ReadAll(response.Body)
+	if string(body) != "data from pretend remote API" {
+		t.Error("incorrect response body:", string(body))
+	}
 }
 
 func TestTools_RandomString(t *testing.T) {
@@ -354,6 +361,82 @@ func TestTools_WriteJSON(t *testing.T) {
 	}
 }
 
+func TestTools_WriteJSONHeaders(t *testing.T) {
+	testTool := Tools{DefaultHeaders: http.Header{"X-Api-Version": {"1"}, "Cache-Control": {"max-age=60"}, "Vary": {"Origin"}}}
+
+	rr := httptest.NewRecorder()
+	rr.Header().Set("Cache-Control", "private")
+
+	first := http.Header{"Link": {"</a>; rel=\"a\""}, "x-trace": {"one"}, "X-Api-Version": {"2"}}
+	second := http.Header{"Link": {"</b>; rel=\"b\""}, "X-Trace": {"two"}, "Vary": {"Origin", "Accept"}}
+
+	err := testTool.WriteJSON(rr, http.StatusOK, JSONResponse{}, first, second)
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	var headerTests = []struct {
+		key      string
+		expected []string
+	}{
+		{key: "Link", expected: []string{"</a>; rel=\"a\"", "</b>; rel=\"b\""}},
+		{key: "X-Trace", expected: []string{"two"}},
+		{key: "X-Api-Version", expected: []string{"2"}},
+		{key: "Vary", expected: []string{"Origin", "Accept"}},
+		{key: "Cache-Control", expected: []string{"private"}},
+	}
+
+	for _, e := range headerTests {
+		if values := rr.Header().Values(e.key); strings.Join(values, "|") != strings.Join(e.expected, "|") {
+			t.Errorf("%s: expected %v but received %v", e.key, e.expected, values)
+		}
+	}
+
+	// default headers are added to error responses
+	rr = httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, errors.New("failed"))
+	if rr.Header().Get("X-Api-Version") != "1" {
+		t.Errorf("default headers missing from error response: %v", rr.Header())
+	}
+}
+
+func TestTools_WriteJSONHardened(t *testing.T) {
+	testTool := Tools{SecureJSONHeaders: true, DisableJSONHTMLEscaping: true, JSONPrefix: ")]}',\n"}
+
+	rr := httptest.NewRecorder()
+	err := testTool.WriteJSON(rr, http.StatusOK, JSONResponse{Message: "<b>fish & chips</b>"})
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/json; charset=utf-8" || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("incorrect security headers: %v", rr.Header())
+	}
+	if rr.Header().Get("Cache-Control") != "" {
+		t.Error("successful response should not be marked no-store")
+	}
+	if rr.Body.String() != ")]}',\n"+`{"error":false,"message":"<b>fish & chips</b>"}` {
+		t.Errorf("incorrect body: %s", rr.Body.String())
+	}
+
+	// error responses are not cached, in either format
+	for _, problemDetails := range []bool{false, true} {
+		testTool.UseProblemDetails = problemDetails
+		rr = httptest.NewRecorder()
+		_ = testTool.ErrorJSON(rr, errors.New("failed"))
+		if rr.Header().Get("Cache-Control") != "no-store" || rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("problem details %t: incorrect error headers: %v", problemDetails, rr.Header())
+		}
+	}
+
+	// HTML is escaped by default
+	rr = httptest.NewRecorder()
+	_ = (&Tools{}).WriteJSON(rr, http.StatusOK, JSONResponse{Message: "<b>"})
+	if rr.Body.String() != `{"error":false,"message":"\u003cb\u003e"}` {
+		t.Errorf("incorrect default body: %s", rr.Body.String())
+	}
+}
+
 func TestTools_ErrorJSON(t *testing.T) {
 	var testTool Tools
 
@@ -381,3 +464,56 @@ func TestTools_ErrorJSON(t *testing.T) {
 		t.Errorf("incorrect status code returned: expected 503, received %d", rr.Code)
 	}
 }
+
+func TestTools_ErrorJSONFieldErrors(t *testing.T) {
+	var testTool Tools
+
+	// decoding error from ReadJSON
+	var decodedJSON struct {
+		Foo string `json:"foo"`
+	}
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"foo": 99}`)))
+	err := testTool.ReadJSON(httptest.NewRecorder(), req, &decodedJSON)
+
+	var jsonError *JSONError
+	if !errors.As(err, &jsonError) {
+		t.Fatalf("JSONError expected but received %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	err = testTool.ErrorJSON(rr, err)
+	if err != nil {
+		t.Errorf("error JSON(): %v", err)
+	}
+
+	var payload JSONResponse
+	err = json.NewDecoder(rr.Body).Decode(&payload)
+	if err != nil {
+		t.Error("received error when decoding JSON:", err)
+	}
+
+	if payload.Message == "" {
+		t.Error("message missing from error response")
+	}
+
+	if len(payload.Errors) != 1 || payload.Errors[0].Field != "foo" || payload.Errors[0].Code != CodeType {
+		t.Errorf("incorrect field errors returned: %+v", payload.Errors)
+	}
+
+	// plain error has no field errors
+	rr = httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, errors.New("plain error"))
+	if bytes.Contains(rr.Body.Bytes(), []byte(`"errors"`)) {
+		t.Error("errors member should be omitted for plain errors:", rr.Body.String())
+	}
+
+	// errors concerning the whole body have no field errors
+	for _, problemDetails := range []bool{false, true} {
+		testTool.UseProblemDetails = problemDetails
+		rr = httptest.NewRecorder()
+		_ = testTool.ErrorJSON(rr, &JSONError{Code: CodeEmptyBody, Message: "body must not be empty"})
+		if bytes.Contains(rr.Body.Bytes(), []byte(`"errors"`)) {
+			t.Errorf("problem details %t: errors member should be omitted for body errors: %s", problemDetails, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package toolkit
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// validationRegexps caches compiled 'regex' rule patterns
+var validationRegexps sync.Map
+
+// ValidationErrors holds every FieldError found when validating a request body
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, e := range v {
+		messages[i] = e.Message
+	}
+
+	return fmt.Sprintf("request body failed validation: %s", strings.Join(messages, "; "))
+}
+
+// FieldErrors returns every field which failed validation
+func (v ValidationErrors) FieldErrors() []FieldError {
+	return v
+}
+
+// Validate checks data, a struct or a pointer to a struct, against the rules given in the 'validate' tags of its fields,
+// descending into nested structs and slices. Fields are identified by their JSON path e.g. items[3].price and every
+// failure is returned together as ValidationErrors. Rules are separated by commas...
+// 1. 'required' - value must not be the zero value, nil or empty.
+// 2. 'omitempty' - skip the remaining rules when the value is the zero value.
+// 3. 'min=n', 'max=n' - numbers are compared by value, strings by character count & slices/maps by item count.
+// 4. 'len=n' - strings must contain exactly n characters & slices/maps exactly n items.
+// 5. 'regex=pattern' - string must match pattern (which may not contain a comma; use \x2C instead).
+// 6. 'email', 'url' - string must be a plain email address or an absolute URL.
+// 7. 'oneof=a b c' - value must be one of the space separated options
+func (t *Tools) Validate(data interface{}) error {
+	return validate(data, jsonFieldName)
+}
+
+// validate checks data against its validation rules, naming fields in paths with fieldName
+func validate(data interface{}, fieldName func(field reflect.StructField) (string, bool)) error {
+	var errs ValidationErrors
+	err := validateValue(reflect.ValueOf(data), "", fieldName, &errs)
+	if err != nil {
+		return err
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// validateValue applies the field rules of any struct found in v, recording failures in errs
+func validateValue(v reflect.Value, path string, fieldName func(field reflect.StructField) (string, bool), errs *ValidationErrors) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			// unexported fields are skipped unless embedded, as their exported fields are promoted
+			if !field.IsExported() && !field.Anonymous {
+				continue
+			}
+
+			// use the JSON (or form) name of the field in its path, embedded structs share the path of their parent
+			name, ok := fieldName(field)
+			if !ok {
+				continue
+			}
+			fieldPath := path
+			if tagName, _, _ := strings.Cut(field.Tag.Get("json"), ","); !field.Anonymous || tagName != "" {
+				fieldPath = joinFieldPath(path, name)
+			}
+
+			tag := field.Tag.Get("validate")
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				err := applyValidationRules(v.Field(i), fieldPath, tag, errs)
+				if err != nil {
+					return err
+				}
+			}
+
+			err := validateValue(v.Field(i), fieldPath, fieldName, errs)
+			if err != nil {
+				return err
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err := validateValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), fieldName, errs)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyValidationRules checks v against each of the comma separated rules in tag
+func applyValidationRules(v reflect.Value, path, tag string, errs *ValidationErrors) error {
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		// nil pointers can only fail 'required', all other rules apply to the value pointed to
+		isNil := false
+		value := v
+		for value.Kind() == reflect.Pointer || value.Kind() == reflect.Interface {
+			if value.IsNil() {
+				isNil = true
+				break
+			}
+			value = value.Elem()
+		}
+
+		// a non-nil pointer is present even when it points to a zero value
+		isEmpty := isNil
+		if v.Kind() != reflect.Pointer && v.Kind() != reflect.Interface {
+			isEmpty = v.IsZero() || (hasLength(v) && v.Len() == 0)
+		}
+
+		switch name {
+		case "":
+			continue
+
+		case "required":
+			if isEmpty {
+				*errs = append(*errs, FieldError{Field: path, Code: name, Message: fmt.Sprintf("%s is required", path)})
+				return nil
+			}
+			continue
+
+		case "omitempty":
+			if isEmpty {
+				return nil
+			}
+			continue
+		}
+
+		if isNil {
+			continue
+		}
+
+		message, err := checkValidationRule(value, name, param)
+		if err != nil {
+			return fmt.Errorf("validation rule %q for field %s: %s", rule, path, err.Error())
+		}
+		if message != "" {
+			*errs = append(*errs, FieldError{Field: path, Code: name, Message: fmt.Sprintf("%s %s", path, message)})
+			// report only the first failed rule for each field
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// checkValidationRule returns a message describing how v fails rule name, or an error if the rule cannot be applied
+func checkValidationRule(v reflect.Value, name, param string) (string, error) {
+	switch name {
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid parameter %q", param)
+		}
+		size, unit, ok := validationSize(v)
+		if !ok || (name == "len" && unit == "") {
+			return "", fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		switch {
+		case name == "min" && size < limit:
+			return strings.TrimSpace(fmt.Sprintf("must be at least %s %s", param, unit)), nil
+		case name == "max" && size > limit:
+			return strings.TrimSpace(fmt.Sprintf("must be at most %s %s", param, unit)), nil
+		case name == "len" && size != limit:
+			return fmt.Sprintf("must be exactly %s %s", param, unit), nil
+		}
+
+	case "regex":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		rex, err := validationRegexp(param)
+		if err != nil {
+			return "", err
+		}
+		if !rex.MatchString(v.String()) {
+			return "has an invalid format", nil
+		}
+
+	case "email":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		address, err := mail.ParseAddress(v.String())
+		if err != nil || address.Address != v.String() {
+			return "must be a valid email address", nil
+		}
+
+	case "url":
+		if v.Kind() != reflect.String {
+			return "", fmt.Errorf("unsupported field type %s", v.Type())
+		}
+		u, err := url.ParseRequestURI(v.String())
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "must be a valid URL", nil
+		}
+
+	case "oneof":
+		options := strings.Fields(param)
+		s := fmt.Sprint(v.Interface())
+		for _, option := range options {
+			if s == option {
+				return "", nil
+			}
+		}
+		return fmt.Sprintf("must be one of: %s", strings.Join(options, ", ")), nil
+
+	default:
+		return "", fmt.Errorf("unknown rule %q", name)
+	}
+
+	return "", nil
+}
+
+// validationSize returns the numeric value, character count or item count of v, with the unit used in messages
+func validationSize(v reflect.Value) (float64, string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), "items", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), "", true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), "", true
+	}
+
+	return 0, "", false
+}
+
+// hasLength reports whether v is of a kind for which Len may be called
+func hasLength(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+
+	return false
+}
+
+// validationRegexp compiles, or retrieves from the cache, the pattern of a 'regex' rule
+func validationRegexp(pattern string) (*regexp.Regexp, error) {
+	if rex, ok := validationRegexps.Load(pattern); ok {
+		return rex.(*regexp.Regexp), nil
+	}
+
+	rex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	validationRegexps.Store(pattern, rex)
+
+	return rex, nil
+}
+
+// jsonFieldName returns the name used for field in JSON, reporting false if the field is ignored by encoding/json
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, true
+}
+
+// joinFieldPath appends a field name to the JSON path of its parent
+func joinFieldPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
@@ -0,0 +1,145 @@
+package toolkit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type validationItem struct {
+	SKU   string  `json:"sku" validate:"required,len=6"`
+	Price float64 `json:"price" validate:"min=0.01,max=1000"`
+}
+
+type validationAudit struct {
+	CreatedBy string `json:"created_by" validate:"required"`
+}
+
+type validationOrder struct {
+	validationAudit
+	Email    string           `json:"email" validate:"required,email"`
+	Website  string           `json:"website" validate:"omitempty,url"`
+	Status   string           `json:"status" validate:"oneof=new paid shipped"`
+	Code     string           `json:"code" validate:"regex=^[A-Z]{3}-\\d+$"`
+	Quantity *int             `json:"quantity" validate:"required,min=1"`
+	Items    []validationItem `json:"items" validate:"required,max=3"`
+	Ignored  string           `json:"-" validate:"required"`
+}
+
+var validationTests = []struct {
+	testName       string
+	order          func(o *validationOrder)
+	expectedFields []string
+	expectedCodes  []string
+}{
+	{testName: "valid struct", order: func(o *validationOrder) {}, expectedFields: nil},
+	{testName: "missing required", order: func(o *validationOrder) { o.Email = ""; o.CreatedBy = "" }, expectedFields: []string{"created_by", "email"}, expectedCodes: []string{"required", "required"}},
+	{testName: "invalid email", order: func(o *validationOrder) { o.Email = "Joe <joe@example.com>" }, expectedFields: []string{"email"}, expectedCodes: []string{"email"}},
+	{testName: "invalid url", order: func(o *validationOrder) { o.Website = "example.com" }, expectedFields: []string{"website"}, expectedCodes: []string{"url"}},
+	{testName: "not one of", order: func(o *validationOrder) { o.Status = "lost" }, expectedFields: []string{"status"}, expectedCodes: []string{"oneof"}},
+	{testName: "regex mismatch", order: func(o *validationOrder) { o.Code = "abc-1" }, expectedFields: []string{"code"}, expectedCodes: []string{"regex"}},
+	{testName: "nil pointer", order: func(o *validationOrder) { o.Quantity = nil }, expectedFields: []string{"quantity"}, expectedCodes: []string{"required"}},
+	{testName: "pointer below min", order: func(o *validationOrder) { zero := 0; o.Quantity = &zero }, expectedFields: []string{"quantity"}, expectedCodes: []string{"min"}},
+	{testName: "too many items", order: func(o *validationOrder) { o.Items = append(o.Items, o.Items[0], o.Items[0], o.Items[0]) }, expectedFields: []string{"items"}, expectedCodes: []string{"max"}},
+	{testName: "empty items", order: func(o *validationOrder) { o.Items = []validationItem{} }, expectedFields: []string{"items"}, expectedCodes: []string{"required"}},
+	{testName: "nested slice fields", order: func(o *validationOrder) {
+		o.Items = append(o.Items, validationItem{SKU: "AB", Price: 5000})
+	}, expectedFields: []string{"items[1].sku", "items[1].price"}, expectedCodes: []string{"len", "max"}},
+}
+
+func TestTools_Validate(t *testing.T) {
+	var testTool Tools
+
+	for _, test := range validationTests {
+		quantity := 2
+		order := validationOrder{
+			validationAudit: validationAudit{CreatedBy: "admin"},
+			Email:           "joe@example.com",
+			Status:          "paid",
+			Code:            "ABC-123",
+			Quantity:        &quantity,
+			Items:           []validationItem{{SKU: "ABC123", Price: 9.99}},
+		}
+		test.order(&order)
+
+		err := testTool.Validate(&order)
+		if len(test.expectedFields) == 0 {
+			if err != nil {
+				t.Errorf("%s: error NOT expected but was generated: %s", test.testName, err.Error())
+			}
+			continue
+		}
+
+		var validationErrors ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			t.Errorf("%s: ValidationErrors expected but received %v", test.testName, err)
+			continue
+		}
+
+		if len(validationErrors) != len(test.expectedFields) {
+			t.Errorf("%s: expected %d field errors, received %v", test.testName, len(test.expectedFields), validationErrors)
+			continue
+		}
+
+		for i, fieldError := range validationErrors {
+			if fieldError.Field != test.expectedFields[i] || fieldError.Code != test.expectedCodes[i] {
+				t.Errorf("%s: expected %s (%s), received %s (%s)", test.testName, test.expectedFields[i], test.expectedCodes[i], fieldError.Field, fieldError.Code)
+			}
+		}
+	}
+}
+
+func TestTools_ValidateBadRule(t *testing.T) {
+	var testTool Tools
+
+	data := struct {
+		Name string `validate:"shiny"`
+		Age  int    `validate:"email"`
+	}{}
+
+	err := testTool.Validate(&data)
+	if err == nil {
+		t.Error("error expected for unknown rule but none received")
+	}
+
+	var validationErrors ValidationErrors
+	if errors.As(err, &validationErrors) {
+		t.Error("unknown rule should not be reported as a validation failure")
+	}
+}
+
+func TestTools_ReadJSONValidate(t *testing.T) {
+	var testTool Tools
+	testTool.ValidateJSON = true
+
+	var decodedJSON struct {
+		Foo string `json:"foo" validate:"required,min=3"`
+	}
+
+	req, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{"foo": "ab"}`)))
+	rr := httptest.NewRecorder()
+
+	err := testTool.ReadJSON(rr, req, &decodedJSON)
+
+	var validationErrors ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		t.Fatalf("ValidationErrors expected but received %v", err)
+	}
+
+	if validationErrors[0].Field != "foo" || validationErrors[0].Code != "min" {
+		t.Errorf("incorrect field error: %+v", validationErrors[0])
+	}
+
+	// validation failures are listed by ErrorJSON
+	rr = httptest.NewRecorder()
+	_ = testTool.ErrorJSON(rr, err)
+
+	var payload JSONResponse
+	_ = json.NewDecoder(rr.Body).Decode(&payload)
+	if len(payload.Errors) != 1 || payload.Errors[0].Field != "foo" {
+		t.Errorf("incorrect field errors in response: %+v", payload.Errors)
+	}
+}
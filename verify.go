@@ -0,0 +1,167 @@
+package toolkit
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReplayStore is used by VerifyWebhook when WebhookReplayStore is not set
+var defaultReplayStore = NewMemoryReplayStore()
+
+// ReplayStore remembers the webhooks received so that VerifyWebhook can reject any received again
+type ReplayStore interface {
+	// Seen records key until expiry, reporting whether it was already recorded
+	Seen(key string, expiry time.Time) bool
+}
+
+// MemoryReplayStore is a ReplayStore held in memory; it is shared only by handlers within the same process. Its zero
+// value is an empty store ready to use
+type MemoryReplayStore struct {
+	mu        sync.Mutex
+	keys      map[string]time.Time
+	nextPrune time.Time
+}
+
+// NewMemoryReplayStore returns an empty MemoryReplayStore
+func NewMemoryReplayStore() *MemoryReplayStore {
+	return &MemoryReplayStore{keys: make(map[string]time.Time)}
+}
+
+// Seen records key until expiry, reporting whether it was already recorded
+func (s *MemoryReplayStore) Seen(key string, expiry time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.keys == nil {
+		s.keys = make(map[string]time.Time)
+	}
+
+	// forget expired keys, at most once a minute
+	now := time.Now()
+	if now.After(s.nextPrune) {
+		for k, e := range s.keys {
+			if now.After(e) {
+				delete(s.keys, k)
+			}
+		}
+		s.nextPrune = now.Add(time.Minute)
+	}
+
+	if e, ok := s.keys[key]; ok && !now.After(e) {
+		return true
+	}
+	s.keys[key] = expiry
+
+	return false
+}
+
+// VerifyWebhook checks that the body of a webhook request was signed with one of secrets (several may be given while
+// secrets are rotated), using the signature header (WebhookSignatureHeader, default X-Webhook-Signature) in the format
+// produced by WebhookSignature. Requests whose timestamp differs from the current time by more than WebhookTolerance
+// (default 5 minutes), or which have been received before, are rejected. The body is restored afterwards so that
+// ReadJSON can decode it. Errors are reported as a *JSONError with a 401 Unauthorized status
+func (t *Tools) VerifyWebhook(w http.ResponseWriter, r *http.Request, secrets ...[]byte) error {
+	maxBytes := t.jsonPayloadLimit()
+	invalid := func(err error, message string) error {
+		return &JSONError{Code: CodeInvalidSignature, Message: message, Err: err}
+	}
+
+	// read the raw body, exactly as signed
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return jsonDecodeError(err, maxBytes)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	header := t.WebhookSignatureHeader
+	if header == "" {
+		header = "X-Webhook-Signature"
+	}
+	timestamp, signatures := parseWebhookSignature(r.Header.Get(header))
+	if timestamp == "" || len(signatures) == 0 {
+		return invalid(ErrInvalidSignature, fmt.Sprintf("request must include a valid %s header", header))
+	}
+
+	// check timestamp is recent, in either direction to allow for clock skew
+	tolerance := 5 * time.Minute
+	if t.WebhookTolerance > 0 {
+		tolerance = t.WebhookTolerance
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return invalid(ErrInvalidSignature, "webhook signature contains an invalid timestamp")
+	}
+	signedAt := time.Unix(seconds, 0)
+	if age := time.Since(signedAt); age > tolerance || age < -tolerance {
+		return invalid(ErrExpiredWebhook, "webhook timestamp is outside the allowed tolerance")
+	}
+
+	// compare signatures in constant time
+	var matched string
+	for _, secret := range secrets {
+		_, expected := parseWebhookSignature(WebhookSignature(secret, seconds, body))
+		expectedMAC, _ := hex.DecodeString(expected[0])
+		for _, signature := range signatures {
+			mac, err := hex.DecodeString(signature)
+			if err == nil && hmac.Equal(mac, expectedMAC) {
+				matched = signature
+			}
+		}
+	}
+	if matched == "" {
+		return invalid(ErrInvalidSignature, "webhook signature does not match")
+	}
+
+	// reject webhooks already received, remembering each until its timestamp is no longer acceptable
+	store := t.WebhookReplayStore
+	if store == nil {
+		store = defaultReplayStore
+	}
+	if store.Seen(matched, signedAt.Add(tolerance)) {
+		return invalid(ErrReplayedWebhook, "webhook has already been received")
+	}
+
+	return nil
+}
+
+// VerifyWebhookMiddleware returns middleware which calls VerifyWebhook for every request, responding with ErrorJSON
+// if verification fails, so that handlers only receive verified webhooks
+func (t *Tools) VerifyWebhookMiddleware(secrets ...[]byte) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := t.VerifyWebhook(w, r, secrets...); err != nil {
+				_ = t.ErrorJSON(w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseWebhookSignature splits a 't=timestamp,v1=signature' header into its timestamp and v1 signatures
+func parseWebhookSignature(header string) (string, []string) {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	return timestamp, signatures
+}
@@ -0,0 +1,108 @@
+package toolkit
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTools_VerifyWebhook(t *testing.T) {
+	secret, oldSecret := []byte("current"), []byte("previous")
+	body := []byte(`{"event":"order.created","id":42}`)
+	now := time.Now().Unix()
+
+	var verifyTests = []struct {
+		testName    string
+		signature   string
+		body        []byte
+		expectedErr error
+	}{
+		{testName: "valid", signature: WebhookSignature(secret, now, body), body: body},
+		{testName: "rotated secret", signature: WebhookSignature(oldSecret, now-1, body), body: body},
+		{testName: "several signatures", signature: WebhookSignature(secret, now-2, body) + ",v1=00ff", body: body},
+		{testName: "missing header", signature: "", body: body, expectedErr: ErrInvalidSignature},
+		{testName: "wrong secret", signature: WebhookSignature([]byte("wrong"), now, body), body: body, expectedErr: ErrInvalidSignature},
+		{testName: "altered body", signature: WebhookSignature(secret, now-3, body), body: []byte(`{"event":"order.created","id":43}`), expectedErr: ErrInvalidSignature},
+		{testName: "expired", signature: WebhookSignature(secret, now-600, body), body: body, expectedErr: ErrExpiredWebhook},
+		{testName: "future", signature: WebhookSignature(secret, now+600, body), body: body, expectedErr: ErrExpiredWebhook},
+		{testName: "replayed", signature: WebhookSignature(secret, now, body), body: body, expectedErr: ErrReplayedWebhook},
+	}
+
+	testTool := Tools{WebhookReplayStore: NewMemoryReplayStore()}
+
+	for _, e := range verifyTests {
+		req := httptest.NewRequest("POST", "/hooks", bytes.NewReader(e.body))
+		req.Header.Set("X-Webhook-Signature", e.signature)
+
+		err := testTool.VerifyWebhook(httptest.NewRecorder(), req, secret, oldSecret)
+
+		if e.expectedErr == nil {
+			if err != nil {
+				t.Errorf("%s: error NOT expected but was generated: %s", e.testName, err.Error())
+				continue
+			}
+			// body can still be decoded
+			var decoded struct {
+				Event string `json:"event"`
+				ID    int    `json:"id"`
+			}
+			if err := testTool.ReadJSON(httptest.NewRecorder(), req, &decoded); err != nil || decoded.ID != 42 {
+				t.Errorf("%s: body not decodable after verification: %+v (%v)", e.testName, decoded, err)
+			}
+			continue
+		}
+
+		var jsonError *JSONError
+		if !errors.Is(err, e.expectedErr) || !errors.As(err, &jsonError) || jsonError.StatusCode() != http.StatusUnauthorized {
+			t.Errorf("%s: expected %v but received %v", e.testName, e.expectedErr, err)
+		}
+	}
+}
+
+func TestTools_VerifyWebhookMiddleware(t *testing.T) {
+	secret := []byte("current")
+	body := []byte(`{"id":1}`)
+	testTool := Tools{WebhookReplayStore: NewMemoryReplayStore(), WebhookSignatureHeader: "X-Signature"}
+
+	called := 0
+	handler := testTool.VerifyWebhookMiddleware(secret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	signature := WebhookSignature(secret, time.Now().Unix(), body)
+	for _, expectedStatus := range []int{http.StatusNoContent, http.StatusUnauthorized} {
+		req := httptest.NewRequest("POST", "/hooks", bytes.NewReader(body))
+		req.Header.Set("X-Signature", signature)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != expectedStatus {
+			t.Errorf("expected status %d but received %d", expectedStatus, rr.Code)
+		}
+	}
+
+	if called != 1 {
+		t.Errorf("expected handler to be called once but it was called %d times", called)
+	}
+}
+
+func TestTools_MemoryReplayStore(t *testing.T) {
+	// zero value is ready to use
+	var store MemoryReplayStore
+	expiry := time.Now().Add(time.Minute)
+
+	if store.Seen("a", expiry) {
+		t.Error("new key reported as seen")
+	}
+	if !store.Seen("a", expiry) {
+		t.Error("repeated key not reported as seen")
+	}
+	if store.Seen("b", time.Now().Add(-time.Second)) || store.Seen("b", expiry) {
+		t.Error("expired key reported as seen")
+	}
+}
@@ -0,0 +1,680 @@
+package toolkit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// validDeliveryID restricts delivery IDs to characters which are safe to use as file names
+var validDeliveryID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ErrDeliveryNotFound is returned by a WebhookQueue asked for a delivery it does not hold
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting to be attempted, or attempted again
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered deliveries received a 2xx response
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDeadLetter deliveries failed on every attempt and will not be attempted again unless redelivered
+	DeliveryDeadLetter DeliveryStatus = "dead_letter"
+)
+
+// WebhookDelivery is a webhook payload to be delivered to a URL, along with the progress of its delivery
+type WebhookDelivery struct {
+	ID             string          `json:"id"`
+	URL            string          `json:"url"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    time.Time       `json:"next_attempt"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	LastAttempt    time.Time       `json:"last_attempt"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    time.Time       `json:"delivered_at"`
+}
+
+// finishedAt returns when delivery was last attempted, or created if it never has been
+func (delivery WebhookDelivery) finishedAt() time.Time {
+	if delivery.LastAttempt.IsZero() {
+		return delivery.CreatedAt
+	}
+
+	return delivery.LastAttempt
+}
+
+// WebhookQueue stores webhook deliveries for a WebhookDispatcher; implementations must be safe for concurrent use and
+// should keep pending deliveries apart from finished ones, so that listing those pending stays cheap as the number
+// delivered grows
+type WebhookQueue interface {
+	// Save adds a delivery to the queue, or replaces the delivery with the same ID
+	Save(delivery WebhookDelivery) error
+	// Get returns the delivery with the given ID, or ErrDeliveryNotFound
+	Get(id string) (WebhookDelivery, error)
+	// List returns every delivery with the given status, oldest first
+	List(status DeliveryStatus) ([]WebhookDelivery, error)
+	// Delete removes the delivery with the given ID, or returns ErrDeliveryNotFound
+	Delete(id string) error
+}
+
+// MemoryWebhookQueue is a WebhookQueue held in memory, so deliveries are lost when the process ends. Its zero value
+// is an empty queue ready to use
+type MemoryWebhookQueue struct {
+	mu       sync.Mutex
+	pending  map[string]WebhookDelivery
+	finished map[string]WebhookDelivery
+}
+
+// NewMemoryWebhookQueue returns an empty MemoryWebhookQueue
+func NewMemoryWebhookQueue() *MemoryWebhookQueue {
+	return &MemoryWebhookQueue{pending: make(map[string]WebhookDelivery), finished: make(map[string]WebhookDelivery)}
+}
+
+// Save adds a delivery to the queue, or replaces the delivery with the same ID
+func (q *MemoryWebhookQueue) Save(delivery WebhookDelivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.pending == nil {
+		q.pending, q.finished = make(map[string]WebhookDelivery), make(map[string]WebhookDelivery)
+	}
+	delete(q.pending, delivery.ID)
+	delete(q.finished, delivery.ID)
+	if delivery.Status == DeliveryPending {
+		q.pending[delivery.ID] = delivery
+	} else {
+		q.finished[delivery.ID] = delivery
+	}
+
+	return nil
+}
+
+// Get returns the delivery with the given ID, or ErrDeliveryNotFound
+func (q *MemoryWebhookQueue) Get(id string) (WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if delivery, ok := q.pending[id]; ok {
+		return delivery, nil
+	}
+	if delivery, ok := q.finished[id]; ok {
+		return delivery, nil
+	}
+
+	return WebhookDelivery{}, ErrDeliveryNotFound
+}
+
+// List returns every delivery with the given status, oldest first
+func (q *MemoryWebhookQueue) List(status DeliveryStatus) ([]WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	held := q.finished
+	if status == DeliveryPending {
+		held = q.pending
+	}
+
+	var deliveries []WebhookDelivery
+	for _, delivery := range held {
+		if delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+// Delete removes the delivery with the given ID, or returns ErrDeliveryNotFound
+func (q *MemoryWebhookQueue) Delete(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	_, isPending := q.pending[id]
+	_, isFinished := q.finished[id]
+	if !isPending && !isFinished {
+		return ErrDeliveryNotFound
+	}
+	delete(q.pending, id)
+	delete(q.finished, id)
+
+	return nil
+}
+
+// FileWebhookQueue is a WebhookQueue which keeps each delivery as a JSON file, so that deliveries survive the process
+// ending. Pending deliveries are kept in a directory and finished ones in its 'finished' subdirectory. A corrupt file
+// is renamed with a '.corrupt' suffix, and reported to Logger if set, rather than failing every List
+type FileWebhookQueue struct {
+	Logger Logger
+
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileWebhookQueue returns a FileWebhookQueue keeping deliveries in dir, creating it if it does not already exist
+func NewFileWebhookQueue(dir string) (*FileWebhookQueue, error) {
+	err := os.MkdirAll(filepath.Join(dir, "finished"), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileWebhookQueue{dir: dir}, nil
+}
+
+// statusDir returns the directory holding deliveries with the given status
+func (q *FileWebhookQueue) statusDir(status DeliveryStatus) string {
+	if status == DeliveryPending {
+		return q.dir
+	}
+
+	return filepath.Join(q.dir, "finished")
+}
+
+// Save adds a delivery to the queue, or replaces the delivery with the same ID; the file is replaced atomically so
+// a delivery is never left half written
+func (q *FileWebhookQueue) Save(delivery WebhookDelivery) error {
+	if !validDeliveryID.MatchString(delivery.ID) {
+		return fmt.Errorf("invalid webhook delivery ID %q", delivery.ID)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.write(delivery)
+}
+
+// write saves delivery in the directory for its status, removing it from any other
+func (q *FileWebhookQueue) write(delivery WebhookDelivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+
+	dir := q.statusDir(delivery.Status)
+	tmp, err := os.CreateTemp(dir, delivery.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), filepath.Join(dir, delivery.ID+".json"))
+	if err != nil {
+		return err
+	}
+
+	// a delivery changing between pending & finished leaves its previous file behind
+	for _, other := range []string{q.statusDir(DeliveryPending), q.statusDir(DeliveryDelivered)} {
+		if other == dir {
+			continue
+		}
+		err = os.Remove(filepath.Join(other, delivery.ID+".json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Get returns the delivery with the given ID, or ErrDeliveryNotFound
+func (q *FileWebhookQueue) Get(id string) (WebhookDelivery, error) {
+	if !validDeliveryID.MatchString(id) {
+		return WebhookDelivery{}, ErrDeliveryNotFound
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delivery, err := q.read(filepath.Join(q.statusDir(DeliveryPending), id+".json"))
+	if errors.Is(err, ErrDeliveryNotFound) {
+		return q.read(filepath.Join(q.statusDir(DeliveryDelivered), id+".json"))
+	}
+
+	return delivery, err
+}
+
+// List returns every delivery with the given status, oldest first. Finished deliveries found amongst those pending are
+// moved to the finished directory
+func (q *FileWebhookQueue) List(status DeliveryStatus) ([]WebhookDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	files, err := filepath.Glob(filepath.Join(q.statusDir(status), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []WebhookDelivery
+	for _, file := range files {
+		delivery, err := q.read(file)
+		if errors.Is(err, ErrDeliveryNotFound) {
+			continue
+		}
+		if err != nil {
+			q.quarantine(file, err)
+			continue
+		}
+		if status == DeliveryPending && delivery.Status != DeliveryPending {
+			if err := q.write(delivery); err != nil {
+				return nil, err
+			}
+		}
+		if delivery.Status == status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sortDeliveries(deliveries)
+
+	return deliveries, nil
+}
+
+// Delete removes the delivery with the given ID, or returns ErrDeliveryNotFound
+func (q *FileWebhookQueue) Delete(id string) error {
+	if !validDeliveryID.MatchString(id) {
+		return ErrDeliveryNotFound
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	found := false
+	for _, dir := range []string{q.statusDir(DeliveryPending), q.statusDir(DeliveryDelivered)} {
+		err := os.Remove(filepath.Join(dir, id+".json"))
+		if err == nil {
+			found = true
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if !found {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// quarantine renames a file which could not be read so that it is not read again, logging why
+func (q *FileWebhookQueue) quarantine(file string, err error) {
+	renameErr := os.Rename(file, file+".corrupt")
+	if q.Logger == nil {
+		return
+	}
+	if renameErr != nil {
+		q.Logger.Error("unreadable webhook delivery skipped", "file", file, "error", err.Error(), "rename_error", renameErr.Error())
+		return
+	}
+	q.Logger.Error("unreadable webhook delivery set aside", "file", file+".corrupt", "error", err.Error())
+}
+
+// read decodes the delivery held in file
+func (q *FileWebhookQueue) read(file string) (WebhookDelivery, error) {
+	var delivery WebhookDelivery
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return delivery, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return delivery, err
+	}
+
+	err = json.Unmarshal(data, &delivery)
+	if err != nil {
+		return delivery, fmt.Errorf("corrupt webhook delivery %s: %w", filepath.Base(file), err)
+	}
+
+	return delivery, nil
+}
+
+// sortDeliveries orders deliveries oldest first
+func sortDeliveries(deliveries []WebhookDelivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].ID < deliveries[j].ID
+		}
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+}
+
+// WebhookSignature returns the value of the signature header sent with a webhook body at timestamp (Unix seconds)
+// i.e. 't=timestamp,v1=signature' where signature is the hex encoded HMAC-SHA256, keyed with secret, of the
+// timestamp, a full stop and the body
+func WebhookSignature(secret []byte, timestamp int64, body []byte) string {
+	ts := strconv.FormatInt(timestamp, 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "."))
+	mac.Write(body)
+
+	return fmt.Sprintf("t=%s,v1=%s", ts, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// WebhookDispatcher delivers webhooks, queuing each delivery so that failed deliveries are retried with exponential
+// backoff and, after MaxAttempts, dead lettered. Payloads are signed with Secret (see WebhookSignature) and the
+// signature sent in SignatureHeader (default X-Webhook-Signature), together with the delivery ID in X-Webhook-ID, which
+// is also sent as the Idempotency-Key, and the event in X-Webhook-Event. Webhooks are sent using Tools, so its client,
+// middleware, timeout, retry policy and circuit breaker all apply to each attempt. Finished deliveries are deleted
+// once older than Retention
+type WebhookDispatcher struct {
+	Tools  *Tools
+	Queue  WebhookQueue
+	Secret []byte
+	// SignatureHeader is the header carrying the signature (default X-Webhook-Signature)
+	SignatureHeader string
+	// MaxAttempts is the number of attempts made before a delivery is dead lettered (default 5)
+	MaxAttempts int
+	// BaseDelay is the delay before the second attempt, doubling for every attempt thereafter up to MaxDelay
+	// (defaults 30 seconds & 1 hour)
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// PollInterval is how often Run looks for deliveries which are due (default 1 second)
+	PollInterval time.Duration
+	// Retention is how long delivered & dead lettered deliveries are kept after their last attempt before Prune, which
+	// Run calls hourly, deletes them (default 7 days); a negative Retention keeps them indefinitely
+	Retention time.Duration
+	// DeliveryTimeout limits the time spent on each attempt of a delivery, including any retries allowed by the
+	// RemoteRetry policy of Tools (default the RemoteTimeout of Tools)
+	DeliveryTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight map[string]bool
+}
+
+// Enqueue queues payload, encoded as JSON, for delivery to url as the given event, returning the delivery; it is sent
+// by the next call to ProcessDue (or by Run)
+func (d *WebhookDispatcher) Enqueue(url, event string, payload interface{}) (WebhookDelivery, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+	id, err := newIdempotencyKey()
+	if err != nil {
+		return WebhookDelivery{}, err
+	}
+
+	now := time.Now().UTC()
+	delivery := WebhookDelivery{
+		ID:          id,
+		URL:         url,
+		Event:       event,
+		Payload:     data,
+		Status:      DeliveryPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+
+	return delivery, d.Queue.Save(delivery)
+}
+
+// Status returns the delivery with the given ID, showing its progress
+func (d *WebhookDispatcher) Status(id string) (WebhookDelivery, error) {
+	return d.Queue.Get(id)
+}
+
+// DeadLetters returns every delivery which failed on all of its attempts
+func (d *WebhookDispatcher) DeadLetters() ([]WebhookDelivery, error) {
+	return d.Queue.List(DeliveryDeadLetter)
+}
+
+// Redeliver queues a dead lettered delivery to be attempted again, with a fresh set of attempts
+func (d *WebhookDispatcher) Redeliver(id string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delivery, err := d.Queue.Get(id)
+	if err != nil {
+		return err
+	}
+	if delivery.Status != DeliveryDeadLetter {
+		return fmt.Errorf("webhook delivery %s is %s, not dead lettered", id, delivery.Status)
+	}
+
+	delivery.Status, delivery.Attempts, delivery.NextAttempt = DeliveryPending, 0, time.Now().UTC()
+
+	return d.Queue.Save(delivery)
+}
+
+// Prune deletes delivered & dead lettered deliveries last attempted longer ago than Retention, returning the number
+// deleted
+func (d *WebhookDispatcher) Prune() (int, error) {
+	// set default retention if not set by user
+	retention := 7 * 24 * time.Hour
+	if d.Retention != 0 {
+		retention = d.Retention
+	}
+	if retention < 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention)
+
+	pruned := 0
+	for _, status := range []DeliveryStatus{DeliveryDelivered, DeliveryDeadLetter} {
+		deliveries, err := d.Queue.List(status)
+		if err != nil {
+			return pruned, err
+		}
+		for _, delivery := range deliveries {
+			if delivery.finishedAt().After(cutoff) {
+				continue
+			}
+			err := d.Queue.Delete(delivery.ID)
+			if err != nil && !errors.Is(err, ErrDeliveryNotFound) {
+				return pruned, err
+			}
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// Run calls ProcessDue every PollInterval, and Prune every hour, until ctx is done
+func (d *WebhookDispatcher) Run(ctx context.Context) error {
+	// set default poll interval if not set by user
+	interval := time.Second
+	if d.PollInterval > 0 {
+		interval = d.PollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastPruned time.Time
+	for {
+		if _, err := d.ProcessDue(ctx); err != nil && ctx.Err() == nil {
+			d.logError("error processing webhook deliveries", err)
+		}
+		if time.Since(lastPruned) >= time.Hour {
+			lastPruned = time.Now()
+			if _, err := d.Prune(); err != nil {
+				d.logError("error pruning webhook deliveries", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// logError reports err to the Logger of Tools, if set
+func (d *WebhookDispatcher) logError(message string, err error) {
+	if d.Tools != nil && d.Tools.Logger != nil {
+		d.Tools.Logger.Error(message, "error", err.Error())
+	}
+}
+
+// ProcessDue attempts every pending delivery whose next attempt is due, returning the number attempted. Deliveries
+// being attempted by another call to ProcessDue are skipped, so concurrent calls never send a delivery twice
+func (d *WebhookDispatcher) ProcessDue(ctx context.Context) (int, error) {
+	due, err := d.claimDue()
+	if err != nil {
+		return 0, err
+	}
+	defer d.release(due)
+
+	// deliveries are sent without holding the lock, so a slow endpoint does not hold up other calls
+	attempted := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return attempted, ctx.Err()
+		}
+
+		err := d.Queue.Save(d.attempt(ctx, delivery))
+		if err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, nil
+}
+
+// claimDue returns the pending deliveries which are due, marking them as in flight
+func (d *WebhookDispatcher) claimDue() ([]WebhookDelivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending, err := d.Queue.List(DeliveryPending)
+	if err != nil {
+		return nil, err
+	}
+	if d.inFlight == nil {
+		d.inFlight = make(map[string]bool)
+	}
+
+	var due []WebhookDelivery
+	now := time.Now()
+	for _, delivery := range pending {
+		if delivery.NextAttempt.After(now) || d.inFlight[delivery.ID] {
+			continue
+		}
+		d.inFlight[delivery.ID] = true
+		due = append(due, delivery)
+	}
+
+	return due, nil
+}
+
+// release marks deliveries as no longer in flight
+func (d *WebhookDispatcher) release(deliveries []WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		delete(d.inFlight, delivery.ID)
+	}
+}
+
+// attempt sends delivery, returning it updated with the outcome
+func (d *WebhookDispatcher) attempt(ctx context.Context, delivery WebhookDelivery) WebhookDelivery {
+	t := d.Tools
+	if t == nil {
+		t = &Tools{}
+	}
+	signatureHeader := d.SignatureHeader
+	if signatureHeader == "" {
+		signatureHeader = "X-Webhook-Signature"
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set(signatureHeader, WebhookSignature(d.Secret, time.Now().Unix(), delivery.Payload))
+	header.Set("X-Webhook-ID", delivery.ID)
+	header.Set("Idempotency-Key", delivery.ID)
+	if delivery.Event != "" {
+		header.Set("X-Webhook-Event", delivery.Event)
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, t.remoteTimeout(d.DeliveryTimeout))
+	defer cancel()
+
+	unattempted := delivery
+	delivery.Attempts++
+	delivery.LastAttempt = time.Now().UTC()
+	request, response, err := t.doRemote(callCtx, t.httpClient(), http.MethodPost, delivery.URL, header, delivery.Payload)
+
+	// a delivery abandoned because ctx is done, or never sent because the circuit is open, remains pending without
+	// the attempt being counted
+	if err != nil && (ctx.Err() != nil || errors.Is(err, ErrCircuitOpen)) {
+		unattempted.LastError = remoteCallError(callCtx, err).Error()
+		return unattempted
+	}
+
+	if err == nil {
+		defer response.Body.Close()
+		_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 1<<20))
+
+		delivery.LastStatusCode = response.StatusCode
+		if response.StatusCode >= 200 && response.StatusCode <= 299 {
+			delivery.Status, delivery.LastError, delivery.DeliveredAt = DeliveryDelivered, "", time.Now().UTC()
+			return delivery
+		}
+		err = newRemoteError(request, &RemoteResponse{StatusCode: response.StatusCode, Header: response.Header})
+	} else {
+		err = remoteCallError(callCtx, err)
+		delivery.LastStatusCode = 0
+	}
+	delivery.LastError = err.Error()
+
+	// set default number of attempts if not set by user
+	maxAttempts := 5
+	if d.MaxAttempts > 0 {
+		maxAttempts = d.MaxAttempts
+	}
+	if delivery.Attempts >= maxAttempts {
+		delivery.Status = DeliveryDeadLetter
+		if t.Logger != nil {
+			t.Logger.Error("webhook delivery dead lettered", "id", delivery.ID, "url", delivery.URL,
+				"attempts", delivery.Attempts, "error", delivery.LastError)
+		}
+		return delivery
+	}
+
+	// schedule next attempt, respecting any Retry-After header
+	policy := RetryPolicy{BaseDelay: 30 * time.Second, MaxDelay: time.Hour}
+	if d.BaseDelay > 0 {
+		policy.BaseDelay = d.BaseDelay
+	}
+	if d.MaxDelay > 0 {
+		policy.MaxDelay = d.MaxDelay
+	}
+	delay, ok := policy.backoff(delivery.Attempts, response)
+	if !ok {
+		delay = policy.MaxDelay
+	}
+	delivery.NextAttempt = time.Now().UTC().Add(delay)
+
+	return delivery
+}
@@ -0,0 +1,307 @@
+package toolkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTools_WebhookQueues(t *testing.T) {
+	fileQueue, err := NewFileWebhookQueue(t.TempDir())
+	if err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+
+	for name, queue := range map[string]WebhookQueue{"memory": NewMemoryWebhookQueue(), "zero value memory": &MemoryWebhookQueue{}, "file": fileQueue} {
+		if pending, err := queue.List(DeliveryPending); err != nil || len(pending) != 0 {
+			t.Errorf("%s: expected empty queue but received %+v (%v)", name, pending, err)
+		}
+
+		now := time.Now().UTC()
+		deliveries := []WebhookDelivery{
+			{ID: "b", Status: DeliveryPending, Payload: []byte(`{"n":2}`), CreatedAt: now.Add(time.Second)},
+			{ID: "a", Status: DeliveryPending, Payload: []byte(`{"n":1}`), CreatedAt: now},
+			{ID: "c", Status: DeliveryDeadLetter, Payload: []byte(`{}`), CreatedAt: now},
+		}
+		for _, delivery := range deliveries {
+			if err := queue.Save(delivery); err != nil {
+				t.Fatalf("%s: error saving delivery: %s", name, err.Error())
+			}
+		}
+
+		// replace delivery
+		deliveries[0].Attempts = 3
+		_ = queue.Save(deliveries[0])
+
+		delivery, err := queue.Get("b")
+		if err != nil || delivery.Attempts != 3 || string(delivery.Payload) != `{"n":2}` {
+			t.Errorf("%s: incorrect delivery returned: %+v (%v)", name, delivery, err)
+		}
+
+		pending, _ := queue.List(DeliveryPending)
+		if len(pending) != 2 || pending[0].ID != "a" || pending[1].ID != "b" {
+			t.Errorf("%s: incorrect pending deliveries: %+v", name, pending)
+		}
+
+		if _, err := queue.Get("../missing"); !errors.Is(err, ErrDeliveryNotFound) {
+			t.Errorf("%s: expected ErrDeliveryNotFound but received %v", name, err)
+		}
+
+		// finished delivery moves out of those pending
+		deliveries[1].Status = DeliveryDelivered
+		_ = queue.Save(deliveries[1])
+		pending, _ = queue.List(DeliveryPending)
+		delivered, _ := queue.List(DeliveryDelivered)
+		if len(pending) != 1 || pending[0].ID != "b" || len(delivered) != 1 || delivered[0].ID != "a" {
+			t.Errorf("%s: incorrect deliveries after finishing: pending %+v, delivered %+v", name, pending, delivered)
+		}
+
+		// delete
+		if err := queue.Delete("a"); err != nil {
+			t.Errorf("%s: error deleting delivery: %v", name, err)
+		}
+		if _, err := queue.Get("a"); !errors.Is(err, ErrDeliveryNotFound) {
+			t.Errorf("%s: expected deleted delivery to be gone but received %v", name, err)
+		}
+		if err := queue.Delete("a"); !errors.Is(err, ErrDeliveryNotFound) {
+			t.Errorf("%s: expected ErrDeliveryNotFound deleting twice but received %v", name, err)
+		}
+	}
+
+	// file queue survives being reopened
+	reopened, _ := NewFileWebhookQueue(fileQueue.dir)
+	if deadLetters, _ := reopened.List(DeliveryDeadLetter); len(deadLetters) != 1 || deadLetters[0].ID != "c" {
+		t.Errorf("deliveries not persisted: %+v", deadLetters)
+	}
+	if files, _ := filepath.Glob(filepath.Join(fileQueue.dir, "*.json")); len(files) != 1 {
+		t.Errorf("expected only the pending delivery in the queue directory but found %v", files)
+	}
+
+	// corrupt file is set aside rather than failing every list
+	_ = os.WriteFile(filepath.Join(fileQueue.dir, "z.json"), []byte("{not json"), 0644)
+	pending, err := fileQueue.List(DeliveryPending)
+	if err != nil || len(pending) != 1 || pending[0].ID != "b" {
+		t.Errorf("expected corrupt delivery to be skipped but received %+v (%v)", pending, err)
+	}
+	if _, err := os.Stat(filepath.Join(fileQueue.dir, "z.json.corrupt")); err != nil {
+		t.Error("corrupt delivery not set aside:", err)
+	}
+}
+
+func TestTools_WebhookDispatcherPrune(t *testing.T) {
+	queue := NewMemoryWebhookQueue()
+	dispatcher := &WebhookDispatcher{Queue: queue, Retention: time.Hour}
+
+	now := time.Now().UTC()
+	for _, delivery := range []WebhookDelivery{
+		{ID: "old", Status: DeliveryDelivered, LastAttempt: now.Add(-2 * time.Hour)},
+		{ID: "dead", Status: DeliveryDeadLetter, LastAttempt: now.Add(-2 * time.Hour)},
+		{ID: "recent", Status: DeliveryDelivered, LastAttempt: now.Add(-time.Minute)},
+		{ID: "pending", Status: DeliveryPending, CreatedAt: now.Add(-2 * time.Hour)},
+	} {
+		_ = queue.Save(delivery)
+	}
+
+	n, err := dispatcher.Prune()
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 deliveries pruned but pruned %d (%v)", n, err)
+	}
+	for id, kept := range map[string]bool{"old": false, "dead": false, "recent": true, "pending": true} {
+		if _, err := queue.Get(id); (err == nil) != kept {
+			t.Errorf("delivery %s: expected kept %t but received %v", id, kept, err)
+		}
+	}
+
+	// negative retention keeps everything
+	dispatcher.Retention = -1
+	_ = queue.Save(WebhookDelivery{ID: "old", Status: DeliveryDelivered})
+	if n, _ := dispatcher.Prune(); n != 0 {
+		t.Errorf("expected nothing pruned but pruned %d", n)
+	}
+}
+
+func TestTools_WebhookDispatcher(t *testing.T) {
+	secret := []byte("webhook secret")
+
+	var received []*http.Request
+	var receivedBody []string
+	statuses := []int{200, 503, 500, 202}
+	testTool := Tools{HTTPClient: NewTestClient(func(req *http.Request) *http.Response {
+		body, _ := io.ReadAll(req.Body)
+		received, receivedBody = append(received, req), append(receivedBody, string(body))
+		status := statuses[len(received)-1]
+		return &http.Response{StatusCode: status, Status: http.StatusText(status), Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}
+	})}
+
+	dispatcher := &WebhookDispatcher{
+		Tools:       &testTool,
+		Queue:       NewMemoryWebhookQueue(),
+		Secret:      secret,
+		MaxAttempts: 2,
+		BaseDelay:   time.Hour,
+	}
+
+	delivered, _ := dispatcher.Enqueue("http://example.com/hooks", "order.created", map[string]int{"id": 1})
+	failing, _ := dispatcher.Enqueue("http://example.com/hooks", "order.updated", map[string]int{"id": 2})
+
+	// first attempt of each
+	n, err := dispatcher.ProcessDue(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 attempts but made %d (%v)", n, err)
+	}
+
+	// payload is signed
+	request := received[0]
+	signature := request.Header.Get("X-Webhook-Signature")
+	timestamp, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(signature, ",")[0], "t="), 10, 64)
+	if signature != WebhookSignature(secret, timestamp, []byte(receivedBody[0])) || receivedBody[0] != `{"id":1}` {
+		t.Errorf("incorrect signature %q for body %s", signature, receivedBody[0])
+	}
+	if request.Header.Get("X-Webhook-ID") != delivered.ID || request.Header.Get("X-Webhook-Event") != "order.created" {
+		t.Errorf("incorrect webhook headers: %v", request.Header)
+	}
+
+	status, _ := dispatcher.Status(delivered.ID)
+	if status.Status != DeliveryDelivered || status.Attempts != 1 || status.LastStatusCode != 200 {
+		t.Errorf("incorrect status of delivered webhook: %+v", status)
+	}
+
+	status, _ = dispatcher.Status(failing.ID)
+	if status.Status != DeliveryPending || status.Attempts != 1 || status.LastStatusCode != 503 || !status.NextAttempt.After(time.Now()) {
+		t.Errorf("incorrect status of failed webhook: %+v", status)
+	}
+
+	// retry is not due until after backoff
+	if n, _ := dispatcher.ProcessDue(context.Background()); n != 0 {
+		t.Errorf("expected no attempts before backoff but made %d", n)
+	}
+
+	// second failure dead letters the delivery, once the retry is made due
+	status.NextAttempt = time.Now().UTC()
+	_ = dispatcher.Queue.Save(status)
+	_, _ = dispatcher.ProcessDue(context.Background())
+	deadLetters, _ := dispatcher.DeadLetters()
+	if len(deadLetters) != 1 || deadLetters[0].ID != failing.ID || deadLetters[0].Attempts != 2 || deadLetters[0].LastError == "" {
+		t.Fatalf("expected dead lettered delivery but received %+v", deadLetters)
+	}
+
+	// redelivered dead letter is attempted again
+	if err := dispatcher.Redeliver(failing.ID); err != nil {
+		t.Fatal("error NOT expected but was generated:", err)
+	}
+	_, _ = dispatcher.ProcessDue(context.Background())
+	status, _ = dispatcher.Status(failing.ID)
+	if status.Status != DeliveryDelivered || len(received) != 4 {
+		t.Errorf("expected redelivery but delivery is %+v after %d requests", status, len(received))
+	}
+
+	if err := dispatcher.Redeliver(failing.ID); err == nil {
+		t.Error("expected error redelivering a delivered webhook")
+	}
+}
+
+func TestTools_WebhookDispatcherInFlight(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	var requests int32
+	testTool := Tools{HTTPClient: &http.Client{Transport: TransportFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			close(started)
+			<-unblock
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}, nil
+	})}}
+
+	queue := NewMemoryWebhookQueue()
+	dispatcher := &WebhookDispatcher{Tools: &testTool, Queue: queue}
+	slow, _ := dispatcher.Enqueue("http://example.com/slow", "order.created", map[string]int{"id": 1})
+	_ = queue.Save(WebhookDelivery{ID: "dead", Status: DeliveryDeadLetter, URL: "http://example.com/hooks"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = dispatcher.ProcessDue(context.Background())
+	}()
+	<-started
+
+	// while a delivery is being sent the dispatcher is not locked, and the delivery is not sent again
+	if err := dispatcher.Redeliver("dead"); err != nil {
+		t.Error("error NOT expected but was generated:", err)
+	}
+	n, err := dispatcher.ProcessDue(context.Background())
+	if err != nil || n != 1 {
+		t.Errorf("expected only the redelivered webhook to be attempted but attempted %d (%v)", n, err)
+	}
+
+	close(unblock)
+	<-done
+	if status, _ := dispatcher.Status(slow.ID); status.Status != DeliveryDelivered || status.Attempts != 1 {
+		t.Errorf("expected a single successful attempt but delivery is %+v", status)
+	}
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Errorf("expected 2 requests but received %d", requests)
+	}
+}
+
+func TestTools_WebhookDispatcherDeliveryTimeout(t *testing.T) {
+	testTool := Tools{HTTPClient: &http.Client{Transport: blockingTransport{}}}
+	dispatcher := &WebhookDispatcher{Tools: &testTool, Queue: NewMemoryWebhookQueue(), DeliveryTimeout: 20 * time.Millisecond}
+	delivery, _ := dispatcher.Enqueue("http://example.com/hooks", "order.created", map[string]int{"id": 1})
+
+	start := time.Now()
+	_, _ = dispatcher.ProcessDue(context.Background())
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("delivery not abandoned after DeliveryTimeout, took %v", elapsed)
+	}
+	if status, _ := dispatcher.Status(delivery.ID); status.Status != DeliveryPending || status.LastError == "" {
+		t.Errorf("expected timed out delivery to be pending a retry but it is %+v", status)
+	}
+}
+
+func TestTools_WebhookDispatcherUnattempted(t *testing.T) {
+	// delivery abandoned when ctx is done
+	started := make(chan struct{})
+	testTool := Tools{HTTPClient: &http.Client{Transport: TransportFunc(func(req *http.Request) (*http.Response, error) {
+		close(started)
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})}}
+	dispatcher := &WebhookDispatcher{Tools: &testTool, Queue: NewMemoryWebhookQueue(), MaxAttempts: 1}
+	cancelled, _ := dispatcher.Enqueue("http://example.com/hooks", "order.created", map[string]int{"id": 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	_, _ = dispatcher.ProcessDue(ctx)
+	if status, _ := dispatcher.Status(cancelled.ID); status.Status != DeliveryPending || status.Attempts != 0 {
+		t.Errorf("expected cancelled delivery to remain pending without an attempt but it is %+v", status)
+	}
+
+	// delivery not sent as the circuit is open
+	breaker := &CircuitBreaker{FailureThreshold: 1, CoolDown: time.Hour}
+	breaker.record("example.com", circuitFailure)
+	sent := 0
+	testTool = Tools{CircuitBreaker: breaker, HTTPClient: NewTestClient(func(req *http.Request) *http.Response {
+		sent++
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(bytes.NewBufferString(`{}`)), Header: make(http.Header)}
+	})}
+	dispatcher = &WebhookDispatcher{Tools: &testTool, Queue: NewMemoryWebhookQueue(), MaxAttempts: 1}
+	rejected, _ := dispatcher.Enqueue("http://example.com/hooks", "order.created", map[string]int{"id": 2})
+
+	_, _ = dispatcher.ProcessDue(context.Background())
+	status, _ := dispatcher.Status(rejected.ID)
+	if sent != 0 || status.Status != DeliveryPending || status.Attempts != 0 || !strings.Contains(status.LastError, "circuit open") {
+		t.Errorf("expected rejected delivery to remain pending without an attempt but it is %+v after %d requests", status, sent)
+	}
+}